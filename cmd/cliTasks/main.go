@@ -2,32 +2,51 @@ package main
 
 import (
 	"context"
+	"dtq/internal/client"
+	"dtq/internal/cluster"
+	"dtq/internal/conn"
+	"dtq/internal/queue"
+	"dtq/internal/task"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"log"
 	"math/rand/v2"
-
-	"crypto/sha256"
-
-	"github.com/redis/go-redis/v9"
+	"strings"
 )
 
 func main() {
-	fmt.Println("task manager")
-	createTask()
-}
+	codecName := flag.String("codec", "json", "task envelope codec (json|binary)")
+	priorityName := flag.String("priority", "default", "task priority (high|default|low)")
+	flag.Parse()
+
+	codec, err := task.CodecByName(*codecName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	priority, err := queue.ParsePriority(*priorityName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	conn := conn.NewConn()
+	defer conn.Close()
 
-func getRedis() *redis.Client {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     "localhost:6543",
-		Password: "",
-		DB:       0,
-		Protocol: 2,
-	})
+	// producers must spread tasks over the current partition layout of the
+	// cluster, it changes when the cluster is resized
+	partitioner, err := cluster.WatchPartitioner(context.Background(), conn.GetEtcd())
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// ctx := context.Background()
-	return rdb
+	fmt.Println("task manager")
+	createTask(client.NewClient(conn.GetRedis(), partitioner,
+		client.WithCodec(codec),
+	), priority)
 }
 
-func createTask() {
+func createTask(cli client.IClient, priority queue.Priority) {
 
 	ctx := context.Background()
 
@@ -39,20 +58,23 @@ func createTask() {
 		"cleanup-old-data-5",
 	}
 
+	tasks := make([]*task.Task, 0, 2000)
+
 	for i := range 2000 {
 		taskName := taskNames[rand.IntN(len(taskNames))]
 		taskID := fmt.Sprintf("%s-instance-%d", taskName, i) // id unico para a task...
 
-		hash := sha256.Sum256([]byte(taskID))
-		// first hash byte will be 0 - 255 -> 256 possible partitions
-		partition := hash[0]
+		payload, _ := json.Marshal(map[string]int{"instance": i})
+
+		t := task.New(taskName[:strings.LastIndex(taskName, "-")], payload)
+		t.ID = taskID
 
-		queueName := fmt.Sprintf("tasks:%d", partition)
+		tasks = append(tasks, t)
+	}
 
-		err := getRedis().LPush(ctx, queueName, taskID).Err()
-		if err != nil {
-			fmt.Println("erro adicionando task:", err)
-		}
+	if _, err := cli.EnqueueBatch(ctx, tasks, client.WithPriority(priority)); err != nil {
+		fmt.Println("erro adicionando tasks:", err)
+		return
 	}
 
 	fmt.Println("Tasks adicionadas com sucesso!")
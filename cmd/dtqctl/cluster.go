@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"dtq/internal/cluster"
+	"dtq/internal/conn"
+	"dtq/internal/types"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+func runCluster(conn conn.IConn, cmd string, args []string) error {
+	fs := flag.NewFlagSet("cluster "+cmd, flag.ExitOnError)
+	partitions := fs.Int("partitions", 0, "new partition count, or partitions of the routed task type")
+	taskType := fs.String("type", "", "task type routed to the workers supporting it")
+	fs.Parse(args)
+
+	ctx := context.Background()
+
+	switch cmd {
+	case "status":
+		meta, err := cluster.Load(ctx, conn.GetEtcd())
+		if err != nil {
+			return err
+		}
+		printMetadata(meta)
+		return nil
+	case "resize":
+		if *partitions < 1 {
+			return fmt.Errorf("-partitions is required")
+		}
+
+		meta, err := cluster.Resize(ctx, conn.GetEtcd(), *partitions)
+		if err != nil {
+			return err
+		}
+		printMetadata(meta)
+		fmt.Println("workers are migrating tasks, start new workers with -partitions", *partitions)
+		return nil
+	case "route":
+		if *taskType == "" || *partitions < 1 {
+			return fmt.Errorf("-type and -partitions are required")
+		}
+
+		meta, err := cluster.Route(ctx, conn.GetEtcd(), *taskType, *partitions)
+		if err != nil {
+			return err
+		}
+		printMetadata(meta)
+		return nil
+	}
+
+	return fmt.Errorf("unknown cluster command %q", cmd)
+}
+
+func printMetadata(meta cluster.Metadata) {
+	fmt.Printf("epoch:      %d\n", meta.Epoch)
+	fmt.Printf("partitions: %d (ids %d-%d)\n", meta.Partitions, meta.First, meta.First+types.PartitionID(meta.Partitions)-1)
+	if !meta.CreatedAt.IsZero() {
+		fmt.Printf("created:    %s\n", meta.CreatedAt.Format(time.RFC3339))
+	}
+	if !meta.ResizedAt.IsZero() {
+		fmt.Printf("resized:    %s\n", meta.ResizedAt.Format(time.RFC3339))
+	}
+
+	if from := meta.Migrating; from == nil {
+		fmt.Println("migrating:  no")
+	} else {
+		fmt.Printf("migrating:  from epoch %d, %d partitions (ids %d-%d)\n", from.Epoch, from.Partitions, from.First, from.First+types.PartitionID(from.Partitions)-1)
+	}
+
+	routed := slices.Sorted(maps.Keys(meta.Routes))
+	for _, taskType := range routed {
+		route := meta.Routes[taskType]
+		fmt.Printf("route:      %s -> %d partitions (ids %d-%d)\n", taskType, route.Partitions, route.First, route.First+types.PartitionID(route.Partitions)-1)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"dtq/internal/cluster"
+	"dtq/internal/conn"
+	"dtq/internal/cron"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+func runCron(conn conn.IConn, cmd string, args []string) error {
+	fs := flag.NewFlagSet("cron "+cmd, flag.ExitOnError)
+	name := fs.String("name", "", "job name")
+	spec := fs.String("spec", "", "cron expression (minute hour dom month dow) or @hourly, @daily...")
+	taskType := fs.String("type", "", "task type enqueued on every run")
+	payload := fs.String("payload", "", "task payload")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	store := cron.NewStore(conn.GetEtcd())
+
+	switch cmd {
+	case "add":
+		err := store.PutJob(ctx, cron.Job{
+			Name:     *name,
+			Spec:     *spec,
+			TaskType: *taskType,
+			Payload:  []byte(*payload),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println("registered", *name)
+		return nil
+	case "remove":
+		if err := store.DeleteJob(ctx, *name); err != nil {
+			return err
+		}
+		fmt.Println("removed", *name)
+		return nil
+	case "list":
+		return listCron(ctx, conn.GetEtcd(), store)
+	}
+
+	return fmt.Errorf("unknown cron command %q", cmd)
+}
+
+func listCron(ctx context.Context, etcdCli *etcd.Client, store *cron.Store) error {
+	entries, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(entries, func(a, b *cron.Entry) int {
+		return strings.Compare(a.Job.Name, b.Job.Name)
+	})
+
+	meta, err := cluster.Load(ctx, etcdCli)
+	if err != nil {
+		return err
+	}
+	partitioner := meta.Partitioner()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSPEC\tTYPE\tPARTITION\tLAST RUN\tNEXT RUN\tLAST WORKER")
+
+	for _, e := range entries {
+		lastRun, nextRun, lastWorker := "-", "-", "-"
+		if e.State != nil {
+			if !e.State.LastRun.IsZero() {
+				lastRun = e.State.LastRun.Format(time.RFC3339)
+			}
+			nextRun = e.State.NextRun.Format(time.RFC3339)
+			if e.State.LastWorker != "" {
+				lastWorker = string(e.State.LastWorker)
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			e.Job.Name, e.Job.Spec, e.Job.TaskType, cron.JobPartition(partitioner, e.Job.Name), lastRun, nextRun, lastWorker)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/dlq"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func runDLQ(conn conn.IConn, cmd string, args []string) error {
+	fs := flag.NewFlagSet("dlq "+cmd, flag.ExitOnError)
+	partition := fs.Int("partition", -1, "partition of the dead letter list")
+	id := fs.String("id", "", "dead letter entry id")
+	limit := fs.Int64("limit", 50, "max entries listed per partition")
+	all := fs.Bool("all", false, "redrive every entry of the partition")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	q := dlq.NewDLQ(conn)
+
+	if cmd != "list" && *partition < 0 {
+		return errors.New("-partition is required")
+	}
+
+	switch cmd {
+	case "list":
+		return listDLQ(ctx, q, *partition, *limit)
+	case "inspect":
+		return inspectDLQ(ctx, q, types.PartitionID(*partition), *id)
+	case "delete":
+		if err := q.Delete(ctx, types.PartitionID(*partition), *id); err != nil {
+			return err
+		}
+		fmt.Println("deleted", *id)
+		return nil
+	case "redrive":
+		if *all {
+			return redriveAll(ctx, q, types.PartitionID(*partition))
+		}
+		if err := q.Redrive(ctx, types.PartitionID(*partition), *id); err != nil {
+			return err
+		}
+		fmt.Println("redriven", *id)
+		return nil
+	}
+
+	return fmt.Errorf("unknown dlq command %q", cmd)
+}
+
+func listDLQ(ctx context.Context, q dlq.IDLQ, partition int, limit int64) error {
+	var partitions []types.PartitionID
+	if partition >= 0 {
+		partitions = []types.PartitionID{types.PartitionID(partition)}
+	} else {
+		var err error
+		if partitions, err = q.Partitions(ctx); err != nil {
+			return err
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PARTITION\tID\tTASK\tTYPE\tATTEMPTS\tREASON\tFAILED AT\tLAST ERROR")
+
+	for _, p := range partitions {
+		entries, err := q.List(ctx, p, 0, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+				e.Partition, e.ID, e.TaskID, e.TaskType, e.Attempts, e.Reason, e.FailedAt.Format(time.RFC3339), e.LastError)
+		}
+	}
+
+	return tw.Flush()
+}
+
+func inspectDLQ(ctx context.Context, q dlq.IDLQ, partition types.PartitionID, id string) error {
+	e, err := q.Get(ctx, partition, id)
+	if err != nil {
+		return err
+	}
+
+	out := map[string]any{"entry": e}
+	if t, err := task.Decode(e.Task); err == nil {
+		out["decoded_task"] = t
+	} else {
+		out["decode_error"] = err.Error()
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func redriveAll(ctx context.Context, q dlq.IDLQ, partition types.PartitionID) error {
+	redriven := 0
+
+	for {
+		entries, err := q.List(ctx, partition, 0, 100)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		for _, e := range entries {
+			if err := q.Redrive(ctx, partition, e.ID); err != nil && !errors.Is(err, dlq.ErrNotFound) {
+				return err
+			}
+			redriven++
+		}
+	}
+
+	fmt.Println("redriven", redriven, "entries")
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"dtq/internal/conn"
+	"fmt"
+	"os"
+)
+
+const usage = `dtqctl - admin tool for the distributed task queue
+
+usage:
+  dtqctl dlq list    [-partition N] [-limit N]
+  dtqctl dlq inspect -partition N -id ID
+  dtqctl dlq delete  -partition N -id ID
+  dtqctl dlq redrive -partition N (-id ID | -all)
+
+  dtqctl cron add    -name NAME -spec "*/5 * * * *" -type TYPE [-payload JSON]
+  dtqctl cron list
+  dtqctl cron remove -name NAME
+
+  dtqctl workers list
+
+  dtqctl cluster status
+  dtqctl cluster resize -partitions N
+  dtqctl cluster route  -type TYPE -partitions N
+
+  dtqctl ring compare [-partitions N] [-workers N] [-add N] [-remove N] [-strategy NAME] [-bounded-loads EPS] [-zones N]
+`
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// ring commands are simulations, they do not need the cluster
+	if os.Args[1] == "ring" {
+		if err := runRing(os.Args[2], os.Args[3:]); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	conn := conn.NewConn()
+	defer conn.Close()
+
+	var err error
+
+	switch os.Args[1] {
+	case "dlq":
+		err = runDLQ(conn, os.Args[2], os.Args[3:])
+	case "cron":
+		err = runCron(conn, os.Args[2], os.Args[3:])
+	case "workers":
+		err = runWorkers(conn, os.Args[2], os.Args[3:])
+	case "cluster":
+		err = runCluster(conn, os.Args[2], os.Args[3:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
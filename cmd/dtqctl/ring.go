@@ -0,0 +1,208 @@
+package main
+
+import (
+	"dtq/internal/ring"
+	"dtq/internal/types"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// runRing simulates a membership change with every strategy, it does not
+// touch the cluster
+func runRing(cmd string, args []string) error {
+	if cmd != "compare" {
+		return fmt.Errorf("unknown ring command %q", cmd)
+	}
+
+	fs := flag.NewFlagSet("ring "+cmd, flag.ExitOnError)
+	partitions := fs.Int("partitions", types.NUM_PARTITIONS, "partition count")
+	workers := fs.Int("workers", 10, "workers before the change")
+	add := fs.Int("add", 1, "workers joining")
+	remove := fs.Int("remove", 0, "workers leaving, spread over the membership")
+	strategy := fs.String("strategy", "all", "strategy to report (all|consistent|rendezvous|jump|maglev)")
+	bounded := fs.Float64("bounded-loads", 0, "epsilon of the consistent ring bounded loads (0 = off)")
+	zones := fs.Int("zones", 0, "spread the workers round-robin over this many zones, with zone aware placement (0 = off)")
+	fs.Parse(args)
+
+	if *partitions < 1 {
+		return fmt.Errorf("invalid partition count %d", *partitions)
+	}
+	if *zones < 0 {
+		return fmt.Errorf("invalid zone count %d", *zones)
+	}
+	if *workers < 1 || *add < 0 || *remove < 0 || *remove >= *workers+*add {
+		return fmt.Errorf("need at least one worker before and after the change")
+	}
+
+	strategies := ring.Strategies
+	if *strategy != "all" {
+		s, err := ring.ParseStrategy(*strategy)
+		if err != nil {
+			return err
+		}
+		strategies = []ring.Strategy{s}
+	}
+
+	before, after := simulatedMembership(*workers, *add, *remove)
+	zoneOf := simulatedZones(*workers+*add, *zones)
+
+	kept := len(before) - *remove
+	ideal := 1 - float64(kept)/float64(max(len(before), len(after)))
+
+	fmt.Printf("%d partitions, %d -> %d workers (+%d -%d), minimal movement %.1f%%\n\n",
+		*partitions, len(before), len(after), *add, *remove, ideal*100)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *zones > 1 {
+		fmt.Fprintln(tw, "STRATEGY\tMIN\tMAX\tMAX/MEAN\tSTDDEV\tMOVED\tMOVED %\tZONE MAX/MEAN\tSTANDBY %")
+	} else {
+		fmt.Fprintln(tw, "STRATEGY\tMIN\tMAX\tMAX/MEAN\tSTDDEV\tMOVED\tMOVED %")
+	}
+
+	for _, s := range strategies {
+		var opts []ring.RingOption
+		if *bounded > 0 {
+			opts = append(opts, ring.WithBoundedLoads(*bounded))
+		}
+
+		r1, err := buildRing(s, *partitions, before, zoneOf, opts)
+		if err != nil {
+			return err
+		}
+		r2, err := buildRing(s, *partitions, after, zoneOf, opts)
+		if err != nil {
+			return err
+		}
+
+		b := ring.MeasureBalance(r2, after, *partitions)
+		moved := ring.Moved(r1, r2, *partitions)
+
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%.2f\t%d\t%.1f",
+			s, b.Min, b.Max, b.MaxOverMean, b.StdDev, moved, float64(moved)*100/float64(*partitions))
+
+		if *zones > 1 {
+			zoneBalance, standby, err := measureZones(s, *partitions, after, zoneOf, opts, r2.(ring.IZonedRing))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(tw, "\t%.2f\t%.1f", zoneBalance, standby)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+func simulatedMembership(workers, add, remove int) ([]types.WorkerID, []types.WorkerID) {
+	before := make([]types.WorkerID, 0, workers)
+	for i := range workers {
+		before = append(before, types.WorkerID(fmt.Sprintf("worker-%03d", i)))
+	}
+
+	removed := map[int]bool{}
+	for i := range remove {
+		removed[i*workers/remove] = true
+	}
+
+	after := make([]types.WorkerID, 0, workers+add-remove)
+	for i, workerID := range before {
+		if !removed[i] {
+			after = append(after, workerID)
+		}
+	}
+	for i := range add {
+		after = append(after, types.WorkerID(fmt.Sprintf("worker-%03d", workers+i)))
+	}
+
+	return before, after
+}
+
+// simulatedZones puts worker i of simulatedMembership in zone i mod zones,
+// nil when zone aware placement is off
+func simulatedZones(workers, zones int) map[types.WorkerID]string {
+	if zones < 1 {
+		return nil
+	}
+
+	zoneOf := make(map[types.WorkerID]string, workers)
+	for i := range workers {
+		zoneOf[types.WorkerID(fmt.Sprintf("worker-%03d", i))] = fmt.Sprintf("zone-%d", i%zones)
+	}
+	return zoneOf
+}
+
+func buildRing(s ring.Strategy, partitions int, workers []types.WorkerID, zoneOf map[types.WorkerID]string, opts []ring.RingOption) (ring.IHashRing, error) {
+	if _, err := ring.New(s, partitions, opts...); err != nil {
+		return nil, err
+	}
+	factory := func(partitions int) ring.IHashRing {
+		r, _ := ring.New(s, partitions, opts...)
+		return r
+	}
+
+	if zoneOf == nil {
+		r := factory(partitions)
+		for _, workerID := range workers {
+			r.AddNodes(workerID, 1)
+		}
+		return r, nil
+	}
+
+	r := ring.NewZoned(partitions, factory)
+	for _, workerID := range workers {
+		r.AddZonedNode(workerID, 1, zoneOf[workerID])
+	}
+	return r, nil
+}
+
+// measureZones reports the busiest zone against the mean, per worker of the
+// zone, and the share of the partitions of the first zone whose owner, once
+// that zone is lost, is the standby owner predicted beforehand
+func measureZones(s ring.Strategy, partitions int, workers []types.WorkerID, zoneOf map[types.WorkerID]string, opts []ring.RingOption, r ring.IZonedRing) (float64, float64, error) {
+	owned := map[string]int{}
+	members := map[string]int{}
+	for _, workerID := range workers {
+		members[zoneOf[workerID]]++
+	}
+	for partitionID := range partitions {
+		owned[zoneOf[r.GetNodeForPartition(types.PartitionID(partitionID))]]++
+	}
+
+	mean := float64(partitions) / float64(len(workers))
+	zoneBalance := 0.0
+	for zone, n := range members {
+		zoneBalance = max(zoneBalance, float64(owned[zone])/float64(n)/mean)
+	}
+
+	lost := zoneOf[workers[0]]
+	survivors := make([]types.WorkerID, 0, len(workers))
+	for _, workerID := range workers {
+		if zoneOf[workerID] != lost {
+			survivors = append(survivors, workerID)
+		}
+	}
+
+	failover, err := buildRing(s, partitions, survivors, zoneOf, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stranded, predicted := 0, 0
+	for partitionID := range partitions {
+		p := types.PartitionID(partitionID)
+		if zoneOf[r.GetNodeForPartition(p)] != lost {
+			continue
+		}
+		stranded++
+		if failover.GetNodeForPartition(p) == r.GetStandbyForPartition(p) {
+			predicted++
+		}
+	}
+
+	if stranded == 0 {
+		return zoneBalance, 100, nil
+	}
+	return zoneBalance, float64(predicted) * 100 / float64(stranded), nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/registry"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+func runWorkers(conn conn.IConn, cmd string, args []string) error {
+	if cmd != "list" {
+		return fmt.Errorf("unknown workers command %q", cmd)
+	}
+
+	resp, err := conn.GetEtcd().Get(context.Background(), registry.Prefix, etcd.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKER\tVERSION\tHOST\tZONE\tWEIGHT\tTASK TYPES\tMETRICS\tSTARTED AT")
+
+	for _, kv := range resp.Kvs {
+		workerID, ok := registry.WorkerID(kv.Key)
+		if !ok {
+			continue
+		}
+
+		r := registry.Parse(kv.Value)
+
+		startedAt := "-"
+		if !r.StartedAt.IsZero() {
+			startedAt = r.StartedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			workerID, orDash(r.Version), orDash(r.Hostname), orDash(r.Zone), r.Weight,
+			orDash(strings.Join(r.TaskTypes, ",")), orDash(r.MetricsEndpoint), startedAt)
+	}
+
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -2,13 +2,15 @@ package etcdbridge
 
 import (
 	"context"
+	"dtq/internal/registry"
 	"dtq/internal/types"
+	"dtq/internal/watch"
 	"encoding/json"
 	"log/slog"
 	"os"
-	"strings"
 	"sync"
 
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	etcd "go.etcd.io/etcd/client/v3"
 )
 
@@ -22,6 +24,11 @@ type Bridge struct {
 	MemoryBridge   map[types.WorkerID]string
 	TgroupFilePath string
 
+	// revision is where the watch starts, right after the initial listing. Zero
+	// makes the watch list the workers itself
+	revision int64
+	reporter watch.Reporter
+
 	mu sync.RWMutex
 }
 
@@ -31,76 +38,86 @@ type IEtcdBridge interface {
 	Persist()
 }
 
-func NewEtcdBridge(etcd *etcd.Client) IEtcdBridge {
+func NewEtcdBridge(etcd *etcd.Client, reporter watch.Reporter) IEtcdBridge {
 	return &Bridge{
 		Etcd:           etcd,
 		MemoryBridge:   make(map[types.WorkerID]string),
 		TgroupFilePath: "tgroups.json",
+		reporter:       reporter,
 	}
 }
 
+// WatchWorkers follows the worker registrations from the initial listing, the
+// scrape target of a worker is the metrics endpoint of its record. When the
+// watch lost events the prefix is listed again and the targets replaced
 func (b *Bridge) WatchWorkers() {
-	ctx := context.Background()
-
-	watchCh := b.Etcd.Watch(ctx, "worker_metrics:", etcd.WithPrefix())
-
-	go func() {
-		for {
-			select {
-			case watchResp := <-watchCh:
-				for _, event := range watchResp.Events {
-					switch event.Type {
-					case etcd.EventTypePut:
-						// new worker joined or updated
-						parts := strings.Split(string(event.Kv.Key), ":")
-						if len(parts) >= 2 {
-							workerID := parts[1]
-							endpoint := string(event.Kv.Value)
-
-							slog.Info("[ETCD-BRIDGE] 🟢 Worker joined", "id", workerID, "lease", event.Kv.Lease)
-
-							b.mu.Lock()
-							b.MemoryBridge[types.WorkerID(workerID)] = endpoint
-							b.mu.Unlock()
-
-							b.Persist()
-						}
-					case etcd.EventTypeDelete:
-						// worker exited / lease expired
-						parts := strings.Split(string(event.Kv.Key), ":")
-						if len(parts) >= 2 {
-							workerID := parts[1]
-
-							slog.Info("[ETCD-BRIDGE] 🔴 Worker left", "id", workerID)
-
-							b.mu.Lock()
-							delete(b.MemoryBridge, types.WorkerID(workerID))
-							b.mu.Unlock()
-
-							b.Persist()
-						}
-					}
+	watcher := watch.NewWatcher(b.Etcd, "metrics_targets", registry.Prefix, watch.Handler{
+		Reset: func(kvs []*mvccpb.KeyValue) {
+			b.mu.Lock()
+			b.MemoryBridge = make(map[types.WorkerID]string, len(kvs))
+			b.mu.Unlock()
+
+			b.load(kvs)
+		},
+		Apply: func(event *etcd.Event) {
+			switch event.Type {
+			case etcd.EventTypePut:
+				// new worker joined or updated
+				workerID, ok := registry.WorkerID(event.Kv.Key)
+				endpoint := registry.Parse(event.Kv.Value).MetricsEndpoint
+				if ok && endpoint != "" {
+					slog.Info("[ETCD-BRIDGE] 🟢 Worker joined", "id", workerID, "lease", event.Kv.Lease)
+
+					b.mu.Lock()
+					b.MemoryBridge[workerID] = endpoint
+					b.mu.Unlock()
+
+					b.Persist()
+				}
+			case etcd.EventTypeDelete:
+				// worker exited / lease expired
+				if workerID, ok := registry.WorkerID(event.Kv.Key); ok {
+					slog.Info("[ETCD-BRIDGE] 🔴 Worker left", "id", workerID)
+
+					b.mu.Lock()
+					delete(b.MemoryBridge, workerID)
+					b.mu.Unlock()
+
+					b.Persist()
 				}
-			case <-ctx.Done():
-				slog.Debug("ctx closed")
 			}
-		}
-	}()
+		},
+	}, b.reporter)
+
+	b.mu.RLock()
+	fromRevision := b.revision
+	b.mu.RUnlock()
+
+	go watcher.Run(context.Background(), fromRevision)
 }
 
 func (b *Bridge) LoadInitialWorkers() {
-	resp, err := b.Etcd.Get(context.Background(), "worker_metrics:", etcd.WithPrefix())
+	resp, err := b.Etcd.Get(context.Background(), registry.Prefix, etcd.WithPrefix())
 	if err != nil {
 		slog.Error("failed to load initial workers", "error", err)
 		return
 	}
 
 	b.mu.Lock()
-	for _, kv := range resp.Kvs {
-		parts := strings.Split(string(kv.Key), ":")
-		if len(parts) >= 2 {
-			workerID := types.WorkerID(parts[1])
-			endpoint := string(kv.Value)
+	b.revision = resp.Header.Revision + 1
+	b.mu.Unlock()
+
+	b.load(resp.Kvs)
+}
+
+// load adds the listed workers to the targets, records without a metrics
+// endpoint (workers registered before it was published) are skipped
+func (b *Bridge) load(kvs []*mvccpb.KeyValue) {
+	b.mu.Lock()
+	for _, kv := range kvs {
+		workerID, ok := registry.WorkerID(kv.Key)
+		endpoint := registry.Parse(kv.Value).MetricsEndpoint
+		if ok && endpoint != "" {
 			b.MemoryBridge[workerID] = endpoint
 			slog.Info("[ETCD-BRIDGE] Loaded existing worker", "id", workerID, "endpoint", endpoint)
 		}
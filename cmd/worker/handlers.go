@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"dtq/internal/handler"
+	"dtq/internal/retry"
+	"dtq/internal/task"
+	"log/slog"
+	"time"
+)
+
+// registerHandlers wires the demo task types pushed by cliTasks
+func registerHandlers(r handler.IHandlerRegistry) {
+	// email providers rate limit, back off longer before giving up
+	r.Register("send-email", simulateWork, handler.WithRetryPolicy(retry.Policy{
+		MaxAttempts: 8,
+		Backoff:     retry.JitteredBackoff{Backoff: retry.ExponentialBackoff{Base: 2 * time.Second}},
+		MaxDelay:    10 * time.Minute,
+	}))
+
+	for _, taskType := range []string{
+		"process-image",
+		"generate-report",
+		"calculate-stats",
+		"cleanup-old-data",
+	} {
+		r.Register(taskType, simulateWork)
+	}
+}
+
+func simulateWork(ctx context.Context, t task.Task) error {
+	select {
+	case <-time.After(10 * time.Millisecond):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	slog.Debug("handled task", "task", t.ID, "type", t.Type, "payload", string(t.Payload))
+	return nil
+}
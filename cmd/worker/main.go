@@ -4,23 +4,82 @@ import (
 	"context"
 	etcdbridge "dtq/cmd/etcdBridge"
 	"dtq/internal/conn"
+	"dtq/internal/handler"
 	"dtq/internal/metrics"
 	"dtq/internal/observability"
+	"dtq/internal/queue"
 	"dtq/internal/ring"
 	"dtq/internal/worker"
+	"flag"
 	"fmt"
+	"log"
 	"os"
 	"os/signal"
 	"syscall"
 )
 
 func main() {
-	ring := ring.NewConsistentHashRing(256)
+	cfg := worker.DefaultConfig()
+	flag.IntVar(&cfg.Partitions, "partitions", cfg.Partitions, "partition count, must match the cluster metadata (the first worker records it)")
+	flag.BoolVar(&cfg.ReliableQueue, "reliable", cfg.ReliableQueue, "keep tasks in a processing list until acked (at-least-once)")
+	flag.BoolVar(&cfg.Ordered, "ordered", cfg.Ordered, "consume each partition sequentially in FIFO order")
+	flag.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "tasks handled at the same time")
+	flag.IntVar(&cfg.Prefetch, "prefetch", cfg.Prefetch, "fetched tasks that may wait for a free handler")
+	flag.DurationVar(&cfg.HandlerTimeout, "handler-timeout", cfg.HandlerTimeout, "cancel handlers running longer than this (0 = no limit)")
+	flag.IntVar(&cfg.Weight, "weight", cfg.Weight, "capacity weight, the share of partitions scales with it (0 = number of CPUs)")
+	flag.StringVar(&cfg.Zone, "zone", cfg.Zone, "availability zone (or rack) published in the worker registration")
+	flag.DurationVar(&cfg.SettleWindow, "settle-window", cfg.SettleWindow, "quiet time before membership changes are applied to the ring (0 = apply each event)")
+	flag.Func("priority-mode", "how priority levels are consumed (strict|weighted)", func(mode string) error {
+		switch queue.PriorityMode(mode) {
+		case queue.PriorityStrict, queue.PriorityWeighted:
+			cfg.Priorities.Mode = queue.PriorityMode(mode)
+			return nil
+		}
+		return fmt.Errorf("unknown priority mode %q", mode)
+	})
+	strategy := flag.String("strategy", string(ring.StrategyConsistent), "partition assignment strategy (consistent|rendezvous|jump|maglev), must match on every worker")
+	boundedLoads := flag.Float64("bounded-loads", 0, "cap each worker at (1+epsilon) times its fair share of partitions (0 = plain consistent hashing), must match on every worker")
+	zoneAware := flag.Bool("zone-aware", false, "spread partitions over zones by capacity and compute a standby owner in another zone, must match on every worker")
+	flag.Parse()
+
+	var ringOpts []ring.RingOption
+	if *boundedLoads > 0 {
+		ringOpts = append(ringOpts, ring.WithBoundedLoads(*boundedLoads))
+	}
+
+	assignment, err := ring.ParseStrategy(*strategy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *boundedLoads > 0 && assignment != ring.StrategyConsistent {
+		log.Fatalf("-bounded-loads only applies to the consistent strategy, not %s", assignment)
+	}
+
+	// one ring per partition layout, the worker adds the layout being migrated
+	// from when the cluster is resized
+	if _, err := ring.New(assignment, cfg.Partitions, ringOpts...); err != nil {
+		log.Fatal(err)
+	}
+	factory := func(partitions int) ring.IHashRing {
+		r, _ := ring.New(assignment, partitions, ringOpts...)
+		return r
+	}
+	// the strategy then places the partitions of a zone between its workers
+	if *zoneAware {
+		inner := factory
+		factory = func(partitions int) ring.IHashRing {
+			return ring.NewZoned(partitions, inner)
+		}
+	}
+	layouts := ring.NewLayered(factory, ring.Range{Count: cfg.Partitions})
+
 	conn := conn.NewConn()
 	metrics := metrics.NewMetrics()
-	worker := worker.NewWorker(conn, ring, metrics)
+	handlers := handler.NewHandlerRegistry()
+	registerHandlers(handlers)
+	worker := worker.NewWorker(conn, layouts, metrics, handlers, cfg)
 	prom := observability.InitPrometheus()
-	etcdBridge := etcdbridge.NewEtcdBridge(conn.GetEtcd())
+	etcdBridge := etcdbridge.NewEtcdBridge(conn.GetEtcd(), metrics)
 	etcdBridge.LoadInitialWorkers()
 	etcdBridge.WatchWorkers()
 
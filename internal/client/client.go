@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"dtq/internal/partition"
+	"dtq/internal/queue"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Result tells where a task was enqueued. Queue is the delayed set when the
+// task is scheduled for later
+type Result struct {
+	TaskID    string
+	Partition types.PartitionID
+	Queue     string
+	ProcessAt time.Time
+}
+
+type Client struct {
+	rdb         *redis.Client
+	codec       task.Codec
+	partitioner partition.IPartitioner
+}
+
+type IClient interface {
+	Enqueue(ctx context.Context, t *task.Task, opts ...EnqueueOption) (Result, error)
+	EnqueueAt(ctx context.Context, t *task.Task, at time.Time, opts ...EnqueueOption) (Result, error)
+	EnqueueIn(ctx context.Context, t *task.Task, delay time.Duration, opts ...EnqueueOption) (Result, error)
+	EnqueueBatch(ctx context.Context, tasks []*task.Task, opts ...EnqueueOption) ([]Result, error)
+}
+
+// NewClient enqueues with partitioner, which must follow the partition layout
+// and task type routes of the cluster, see cluster.WatchPartitioner. A fixed
+// partitioner keeps writing to partitions a resize retired
+func NewClient(rdb *redis.Client, partitioner partition.IPartitioner, opts ...ClientOption) IClient {
+	c := &Client{
+		rdb:         rdb,
+		codec:       task.JSONCodec{},
+		partitioner: partitioner,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *Client) Enqueue(ctx context.Context, t *task.Task, opts ...EnqueueOption) (Result, error) {
+	data, res, err := c.prepare(t, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	pipe := c.rdb.Pipeline()
+	push(ctx, pipe, data, res)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Result{}, fmt.Errorf("client: enqueue %s: %w", t.String(), err)
+	}
+
+	return res, nil
+}
+
+// EnqueueAt schedules the task for at. The partition owner moves it to tasks:N
+// once it is due, so it runs at or shortly after at
+func (c *Client) EnqueueAt(ctx context.Context, t *task.Task, at time.Time, opts ...EnqueueOption) (Result, error) {
+	return c.Enqueue(ctx, t, append(opts, withProcessAt(at))...)
+}
+
+func (c *Client) EnqueueIn(ctx context.Context, t *task.Task, delay time.Duration, opts ...EnqueueOption) (Result, error) {
+	return c.Enqueue(ctx, t, append(opts, WithDelay(delay))...)
+}
+
+// EnqueueBatch sends every task in a single pipeline. Options apply to all tasks
+func (c *Client) EnqueueBatch(ctx context.Context, tasks []*task.Task, opts ...EnqueueOption) ([]Result, error) {
+	results := make([]Result, len(tasks))
+
+	pipe := c.rdb.Pipeline()
+	for i, t := range tasks {
+		data, res, err := c.prepare(t, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		push(ctx, pipe, data, res)
+		results[i] = res
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("client: enqueue batch: %w", err)
+	}
+
+	return results, nil
+}
+
+func push(ctx context.Context, pipe redis.Pipeliner, data []byte, res Result) {
+	if res.ProcessAt.IsZero() {
+		pipe.RPush(ctx, res.Queue, data)
+		return
+	}
+
+	pipe.ZAdd(ctx, res.Queue, redis.Z{
+		Score:  float64(res.ProcessAt.UnixMilli()),
+		Member: data,
+	})
+}
+
+// prepare applies the options, picks the partition and encodes the task
+func (c *Client) prepare(t *task.Task, opts []EnqueueOption) ([]byte, Result, error) {
+	var o enqueueOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.processAt.IsZero() && o.delay > 0 {
+		o.processAt = time.Now().Add(o.delay)
+	}
+
+	if t.ID == "" {
+		t.ID = task.NewID()
+	}
+	if t.Headers == nil {
+		t.Headers = map[string]string{}
+	}
+	if t.EnqueuedAt.IsZero() {
+		t.EnqueuedAt = time.Now().UTC()
+	}
+	if o.partitionKey != "" {
+		t.Headers[task.HeaderPartitionKey] = o.partitionKey
+	}
+
+	data, err := c.codec.Encode(t)
+	if err != nil {
+		return nil, Result{}, fmt.Errorf("client: encode %s: %w", t.String(), err)
+	}
+
+	// routed task types have partitions of their own, see cluster.Route
+	partitionID := partition.For(c.partitioner, t.Type, t.PartitionKey())
+
+	res := Result{
+		TaskID:    t.ID,
+		Partition: partitionID,
+		Queue:     queue.PriorityKey(queue.TaskKey(partitionID), o.priority),
+	}
+
+	if o.processAt.After(time.Now()) {
+		res.Queue = queue.PriorityKey(queue.DelayedKey(partitionID), o.priority)
+		res.ProcessAt = o.processAt
+	}
+
+	return data, res, nil
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"dtq/internal/queue"
+	"dtq/internal/task"
+	"time"
+)
+
+type ClientOption func(c *Client)
+
+// WithCodec sets the envelope codec, defaults to json
+func WithCodec(codec task.Codec) ClientOption {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+type enqueueOptions struct {
+	partitionKey string
+	delay        time.Duration
+	processAt    time.Time
+	priority     queue.Priority
+}
+
+type EnqueueOption func(o *enqueueOptions)
+
+// WithPartitionKey routes the task by key instead of its id, tasks sharing a key
+// share a partition
+func WithPartitionKey(key string) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.partitionKey = key
+	}
+}
+
+// WithDelay postpones the task by d, see Client.EnqueueIn
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.delay = d
+	}
+}
+
+func withProcessAt(at time.Time) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.processAt = at
+	}
+}
+
+// WithPriority puts the task in the partition list of that priority level
+func WithPriority(p queue.Priority) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.priority = p
+	}
+}
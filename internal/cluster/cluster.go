@@ -0,0 +1,277 @@
+package cluster
+
+import (
+	"context"
+	"dtq/internal/partition"
+	"dtq/internal/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+// MetadataKey holds the settings every worker and producer of the cluster must agree on
+const MetadataKey = "cluster_metadata"
+
+var (
+	ErrMismatch  = errors.New("cluster: configuration does not match the cluster metadata")
+	ErrMigrating = errors.New("cluster: a partition migration is still running")
+	ErrConflict  = errors.New("cluster: metadata changed concurrently")
+	ErrRouted    = errors.New("cluster: task type already routed")
+)
+
+// Layout is one partition count of the cluster. Each resize starts a new epoch
+// whose partition ids follow the ones of the previous layout, so the tasks:N
+// lists of two layouts never collide and both can be consumed during a migration
+type Layout struct {
+	Epoch      int               `json:"epoch"`
+	First      types.PartitionID `json:"first"`
+	Partitions int               `json:"partitions"`
+}
+
+// Contains tells whether the partition belongs to the layout
+func (l Layout) Contains(partition types.PartitionID) bool {
+	return partition >= l.First && int(partition-l.First) < l.Partitions
+}
+
+// IDs lists the partitions of the layout
+func (l Layout) IDs() []types.PartitionID {
+	ids := make([]types.PartitionID, 0, l.Partitions)
+	for i := range l.Partitions {
+		ids = append(ids, l.First+types.PartitionID(i))
+	}
+	return ids
+}
+
+// Partitioner maps task keys to the partitions of the layout
+func (l Layout) Partitioner() partition.IPartitioner {
+	return partition.NewRangePartitioner(l.First, l.Partitions)
+}
+
+// Metadata is written by the first worker that joins the cluster and changed
+// by Resize. Producers write to the current layout, workers consume it and the
+// layout being migrated from, if any
+type Metadata struct {
+	Layout
+	// Migrating is the previous layout while its tasks are moved to the current one
+	Migrating *Layout `json:"migrating,omitempty"`
+	// Routes are the partitions of the task types routed to the workers that
+	// support them, tasks of other types use the current layout
+	Routes    map[string]Layout `json:"routes,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ResizedAt time.Time         `json:"resized_at,omitzero"`
+
+	// Revision is the etcd revision the metadata was read at
+	Revision int64 `json:"-"`
+}
+
+// Layouts returns the layouts every worker consumes, the current one first
+func (m Metadata) Layouts() []Layout {
+	if m.Migrating == nil {
+		return []Layout{m.Layout}
+	}
+	return []Layout{m.Layout, *m.Migrating}
+}
+
+// Partitioner maps task keys to the current layout, and tasks of a routed type
+// to the partitions of their type
+func (m Metadata) Partitioner() partition.IPartitioner {
+	return router{layout: m.Layout, routes: m.Routes}
+}
+
+// next is the first partition id no layout or route uses yet
+func (m Metadata) next() types.PartitionID {
+	next := m.First + types.PartitionID(m.Partitions)
+	if m.Migrating != nil {
+		next = max(next, m.Migrating.First+types.PartitionID(m.Migrating.Partitions))
+	}
+	for _, route := range m.Routes {
+		next = max(next, route.First+types.PartitionID(route.Partitions))
+	}
+	return next
+}
+
+// Join validates the partition count of a worker against the cluster. The
+// first worker records its count, the others must use the same one: two
+// counts would send the same task key to different partitions
+func Join(ctx context.Context, etcdCli *etcd.Client, partitions int) (Metadata, error) {
+	if partitions < 1 {
+		return Metadata{}, fmt.Errorf("cluster: invalid partition count %d", partitions)
+	}
+
+	meta := Metadata{
+		Layout:    Layout{Partitions: partitions},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	resp, err := etcdCli.Txn(ctx).
+		If(etcd.Compare(etcd.CreateRevision(MetadataKey), "=", 0)).
+		Then(etcd.OpPut(MetadataKey, string(data))).
+		Else(etcd.OpGet(MetadataKey)).
+		Commit()
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	if resp.Succeeded {
+		meta.Revision = resp.Header.Revision
+		return meta, nil
+	}
+
+	meta, err = Decode(resp.Responses[0].GetResponseRange().Kvs[0].Value)
+	if err != nil {
+		return Metadata{}, err
+	}
+	meta.Revision = resp.Header.Revision
+
+	if meta.Partitions != partitions {
+		return meta, fmt.Errorf("%w: %d partitions configured, the cluster has %d", ErrMismatch, partitions, meta.Partitions)
+	}
+
+	return meta, nil
+}
+
+// Load reads the cluster metadata. A cluster no worker joined yet uses the
+// default partition count
+func Load(ctx context.Context, etcdCli *etcd.Client) (Metadata, error) {
+	meta, _, err := load(ctx, etcdCli)
+	return meta, err
+}
+
+func load(ctx context.Context, etcdCli *etcd.Client) (Metadata, int64, error) {
+	resp, err := etcdCli.Get(ctx, MetadataKey)
+	if err != nil {
+		return Metadata{}, 0, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return Metadata{
+			Layout:   Layout{Partitions: types.NUM_PARTITIONS},
+			Revision: resp.Header.Revision,
+		}, 0, nil
+	}
+
+	meta, err := Decode(resp.Kvs[0].Value)
+	meta.Revision = resp.Header.Revision
+	return meta, resp.Kvs[0].ModRevision, err
+}
+
+// Resize starts a new epoch with another partition count. Producers switch to
+// it as soon as they reload the metadata, workers consume both layouts and move
+// the tasks of the previous one over until FinishMigration
+func Resize(ctx context.Context, etcdCli *etcd.Client, partitions int) (Metadata, error) {
+	if partitions < 1 {
+		return Metadata{}, fmt.Errorf("cluster: invalid partition count %d", partitions)
+	}
+
+	meta, modRevision, err := load(ctx, etcdCli)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if modRevision == 0 {
+		return Metadata{}, errors.New("cluster: no worker joined yet, start workers with -partitions instead")
+	}
+	if meta.Migrating != nil {
+		return meta, fmt.Errorf("%w: epoch %d", ErrMigrating, meta.Epoch)
+	}
+	if meta.Partitions == partitions {
+		return meta, fmt.Errorf("cluster: already %d partitions", partitions)
+	}
+
+	previous := meta.Layout
+	meta.Layout = Layout{
+		Epoch:      previous.Epoch + 1,
+		First:      meta.next(),
+		Partitions: partitions,
+	}
+	meta.Migrating = &previous
+	meta.ResizedAt = time.Now().UTC()
+
+	return meta, put(ctx, etcdCli, meta, modRevision)
+}
+
+// Route gives the task type partitions of its own, consumed only by workers
+// that registered a handler for it. Producers send the tasks of the type there
+// as soon as they reload the metadata
+func Route(ctx context.Context, etcdCli *etcd.Client, taskType string, partitions int) (Metadata, error) {
+	if taskType == "" {
+		return Metadata{}, errors.New("cluster: empty task type")
+	}
+	if partitions < 1 {
+		return Metadata{}, fmt.Errorf("cluster: invalid partition count %d", partitions)
+	}
+
+	meta, modRevision, err := load(ctx, etcdCli)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if modRevision == 0 {
+		return Metadata{}, errors.New("cluster: no worker joined yet")
+	}
+	if _, ok := meta.Routes[taskType]; ok {
+		return meta, fmt.Errorf("%w: %s", ErrRouted, taskType)
+	}
+
+	routes := make(map[string]Layout, len(meta.Routes)+1)
+	for t, route := range meta.Routes {
+		routes[t] = route
+	}
+	routes[taskType] = Layout{First: meta.next(), Partitions: partitions}
+	meta.Routes = routes
+
+	return meta, put(ctx, etcdCli, meta, modRevision)
+}
+
+// FinishMigration retires the layout migrated from once epoch's migration is
+// done. It is a no-op when another worker finished it first
+func FinishMigration(ctx context.Context, etcdCli *etcd.Client, epoch int) error {
+	meta, modRevision, err := load(ctx, etcdCli)
+	if err != nil {
+		return err
+	}
+	if meta.Epoch != epoch || meta.Migrating == nil {
+		return nil
+	}
+
+	meta.Migrating = nil
+	return put(ctx, etcdCli, meta, modRevision)
+}
+
+// put writes the metadata if it was not changed since modRevision
+func put(ctx context.Context, etcdCli *etcd.Client, meta Metadata, modRevision int64) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	resp, err := etcdCli.Txn(ctx).
+		If(etcd.Compare(etcd.ModRevision(MetadataKey), "=", modRevision)).
+		Then(etcd.OpPut(MetadataKey, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrConflict
+	}
+	return nil
+}
+
+// Decode reads a metadata value, as stored under MetadataKey
+func Decode(value []byte) (Metadata, error) {
+	var meta Metadata
+	if err := json.Unmarshal(value, &meta); err != nil {
+		return Metadata{}, fmt.Errorf("cluster: bad metadata: %w", err)
+	}
+	if meta.Partitions < 1 {
+		return Metadata{}, fmt.Errorf("cluster: bad metadata: %d partitions", meta.Partitions)
+	}
+	return meta, nil
+}
@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"context"
+	"dtq/internal/partition"
+	"dtq/internal/types"
+	"dtq/internal/watch"
+	"log/slog"
+	"sync/atomic"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+// Partitioner maps keys to the current layout of the cluster and follows the
+// metadata, so a long lived producer writes to the new layout right after a resize
+type Partitioner struct {
+	current atomic.Pointer[Metadata]
+}
+
+// WatchPartitioner loads the metadata and keeps the partitioner up to date
+// until ctx is done
+func WatchPartitioner(ctx context.Context, etcdCli *etcd.Client) (*Partitioner, error) {
+	meta, err := Load(ctx, etcdCli)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Partitioner{}
+	p.current.Store(&meta)
+
+	watcher := watch.NewWatcher(etcdCli, "cluster", MetadataKey, watch.Handler{
+		Reset: func(kvs []*mvccpb.KeyValue) {
+			for _, kv := range kvs {
+				p.update(kv.Value)
+			}
+		},
+		Apply: func(event *etcd.Event) {
+			if event.Type == etcd.EventTypePut {
+				p.update(event.Kv.Value)
+			}
+		},
+	}, nil)
+	go watcher.Run(ctx, meta.Revision+1)
+
+	return p, nil
+}
+
+func (p *Partitioner) update(value []byte) {
+	meta, err := Decode(value)
+	if err != nil {
+		slog.Error("ignoring cluster metadata update", "error", err)
+		return
+	}
+	p.current.Store(&meta)
+}
+
+func (p *Partitioner) Partition(key string) types.PartitionID {
+	return p.current.Load().Partitioner().Partition(key)
+}
+
+func (p *Partitioner) PartitionFor(taskType, key string) types.PartitionID {
+	return partition.For(p.current.Load().Partitioner(), taskType, key)
+}
+
+func (p *Partitioner) Count() int {
+	return p.current.Load().Partitions
+}
+
+// router is the partitioner of a metadata snapshot
+type router struct {
+	layout Layout
+	routes map[string]Layout
+}
+
+func (r router) Partition(key string) types.PartitionID {
+	return r.layout.Partitioner().Partition(key)
+}
+
+func (r router) PartitionFor(taskType, key string) types.PartitionID {
+	if route, ok := r.routes[taskType]; ok {
+		return route.Partitioner().Partition(key)
+	}
+	return r.Partition(key)
+}
+
+func (r router) Count() int {
+	return r.layout.Partitions
+}
@@ -0,0 +1,168 @@
+package cron
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/partition"
+	"dtq/internal/queue"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fireScript enqueues the task only once per (job, fire time). A worker that
+// crashed after enqueueing but before advancing the state makes the next owner
+// retry the same fire time, which is then a no-op
+var fireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], '1', 'NX', 'EX', ARGV[2]) then
+	redis.call('RPUSH', KEYS[2], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// firedTTL is how long a fire time is remembered for deduplication
+const firedTTL = 7 * 24 * time.Hour
+
+// Runner fires the jobs whose partition is owned by this worker. Each job maps
+// to a partition through the same partitioner as tasks, so exactly one worker
+// (the partition owner) fires it
+type Runner struct {
+	conn        conn.IConn
+	store       *Store
+	partitioner partition.IPartitioner
+	workerID    types.WorkerID
+
+	mu sync.RWMutex
+}
+
+func NewRunner(conn conn.IConn, partitioner partition.IPartitioner, workerID types.WorkerID) *Runner {
+	return &Runner{
+		conn:        conn,
+		store:       NewStore(conn.GetEtcd()),
+		partitioner: partitioner,
+		workerID:    workerID,
+	}
+}
+
+// SetPartitioner switches the jobs to another partition layout, after a resize
+func (r *Runner) SetPartitioner(p partition.IPartitioner) {
+	r.mu.Lock()
+	r.partitioner = p
+	r.mu.Unlock()
+}
+
+// JobPartition is the partition owning the job
+func JobPartition(p partition.IPartitioner, name string) types.PartitionID {
+	return p.Partition(partitionKey(name))
+}
+
+func partitionKey(name string) string {
+	return "cron:" + name
+}
+
+// Tick fires every owned job that is due at now. A job behind by several runs
+// fires once per tick until it catches up, runs are never skipped
+func (r *Runner) Tick(ctx context.Context, now time.Time, owns func(partition types.PartitionID) bool) (int, error) {
+	entries, err := r.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	partitioner := r.partitioner
+	r.mu.RUnlock()
+
+	fired := 0
+
+	for _, e := range entries {
+		partitionID := JobPartition(partitioner, e.Job.Name)
+		if !owns(partitionID) {
+			continue
+		}
+
+		ok, err := r.tick(ctx, e, partitioner, now)
+		if err != nil {
+			slog.Error("error firing cron job", "job", e.Job.Name, "error", err)
+			continue
+		}
+		if ok {
+			fired++
+		}
+	}
+
+	return fired, nil
+}
+
+func (r *Runner) tick(ctx context.Context, e *Entry, partitioner partition.IPartitioner, now time.Time) (bool, error) {
+	sched, err := Parse(e.Job.Spec)
+	if err != nil {
+		return false, err
+	}
+
+	// first time we see the job: schedule it from now, nothing is due yet
+	if e.State == nil {
+		_, err := r.store.casState(ctx, e, State{NextRun: sched.Next(now)})
+		return false, err
+	}
+
+	due := e.State.NextRun
+	if due.IsZero() || due.After(now) {
+		return false, nil
+	}
+
+	// the job partition decides who fires it, the task goes where its type is
+	// consumed, a routed type has partitions of its own
+	target := partition.For(partitioner, e.Job.TaskType, partitionKey(e.Job.Name))
+
+	enqueued, err := r.enqueue(ctx, e.Job, target, due)
+	if err != nil {
+		return false, err
+	}
+
+	advanced, err := r.store.casState(ctx, e, State{
+		LastRun:    due,
+		NextRun:    sched.Next(due),
+		LastWorker: r.workerID,
+	})
+	if err != nil {
+		return false, err
+	}
+	if !advanced {
+		slog.Warn("cron state changed concurrently, not advancing", "job", e.Job.Name)
+	}
+
+	return enqueued, nil
+}
+
+func (r *Runner) enqueue(ctx context.Context, job Job, partitionID types.PartitionID, due time.Time) (bool, error) {
+	t := task.New(job.TaskType, job.Payload)
+	// deterministic id, consumers can use it to deduplicate
+	t.ID = fmt.Sprintf("cron:%s:%d", job.Name, due.Unix())
+	for k, v := range job.Headers {
+		t.Headers[k] = v
+	}
+	t.Headers[task.HeaderPartitionKey] = partitionKey(job.Name)
+
+	data, err := task.JSONCodec{}.Encode(t)
+	if err != nil {
+		return false, err
+	}
+
+	firedKey := fmt.Sprintf("cron_fired:%s:%d", job.Name, due.Unix())
+
+	n, err := fireScript.Run(ctx, r.conn.GetRedis(),
+		[]string{firedKey, queue.TaskKey(partitionID)},
+		data, int64(firedTTL.Seconds()),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
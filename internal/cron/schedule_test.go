@@ -0,0 +1,206 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+// bitsOf sets the bits of the given values
+func bitsOf(values ...int) uint64 {
+	var bits uint64
+	for _, v := range values {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+// span sets the bits lo, lo+step, ... up to hi
+func span(lo, hi, step int) uint64 {
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+func TestFieldParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		field field
+		expr  string
+		want  uint64
+	}{
+		{"star", minuteField, "*", span(0, 59, 1)},
+		{"single", minuteField, "7", bitsOf(7)},
+		{"lowest", minuteField, "0", bitsOf(0)},
+		{"highest", minuteField, "59", bitsOf(59)},
+		{"list", minuteField, "1,15,30", bitsOf(1, 15, 30)},
+		{"duplicates", minuteField, "5,5,5", bitsOf(5)},
+		{"range", hourField, "9-17", span(9, 17, 1)},
+		{"single value range", hourField, "4-4", bitsOf(4)},
+		{"star step", minuteField, "*/15", bitsOf(0, 15, 30, 45)},
+		{"step larger than field", minuteField, "*/60", bitsOf(0)},
+		{"step not dividing the field", minuteField, "*/7", span(0, 59, 7)},
+		{"range step", minuteField, "10-20/5", bitsOf(10, 15, 20)},
+		{"range step missing the end", minuteField, "10-21/5", bitsOf(10, 15, 20)},
+		{"start step runs to the end", minuteField, "50/3", bitsOf(50, 53, 56, 59)},
+		{"list of ranges and steps", hourField, "0-2,*/12,23", bitsOf(0, 1, 2, 12, 23)},
+		{"day of month starts at 1", domField, "*", span(1, 31, 1)},
+		{"day of month step", domField, "*/10", bitsOf(1, 11, 21, 31)},
+		{"month names", monthField, "jan,JUN,Dec", bitsOf(1, 6, 12)},
+		{"month name range", monthField, "mar-may", bitsOf(3, 4, 5)},
+		{"month name step", monthField, "jan/3", bitsOf(1, 4, 7, 10)},
+		{"weekday names", dowField, "mon-fri", span(1, 5, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.field.parse(tt.expr)
+			if err != nil {
+				t.Fatalf("parse(%q): %v", tt.expr, err)
+			}
+			if got != tt.want {
+				t.Fatalf("parse(%q) = %b, want %b", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"-1 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"* * * foo *",
+		"* * * * funday",
+		"a * * * *",
+		"1,,2 * * * *",
+		"5- * * * *",
+		"-5 * * * *",
+		"1-2-3 * * * *",
+		"20-10 * * * *",
+		"*/0 * * * *",
+		"*/-2 * * * *",
+		"*/x * * * *",
+		"*/ * * * *",
+		"1/2/3 * * * *",
+		"@every 5m",
+		"@hourlyish",
+	}
+
+	for _, spec := range specs {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := Parse(spec); err == nil {
+				t.Fatalf("Parse(%q) accepted an invalid spec", spec)
+			}
+		})
+	}
+}
+
+func TestParseSundayAsSeven(t *testing.T) {
+	for _, spec := range []string{"0 0 * * 7", "0 0 * * 0", "0 0 * * sun"} {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", spec, err)
+		}
+		if s.dow != bitsOf(0) {
+			t.Fatalf("Parse(%q) dow = %b, want only sunday", spec, s.dow)
+		}
+	}
+
+	s, err := Parse("0 0 * * 5-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.dow != bitsOf(0, 5, 6) {
+		t.Fatalf("5-7 dow = %b, want friday to sunday", s.dow)
+	}
+}
+
+func TestParseDescriptors(t *testing.T) {
+	for descriptor, spec := range descriptors {
+		got, err := Parse("  " + descriptor + " ")
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", descriptor, err)
+		}
+		want, _ := Parse(spec)
+		if *got != *want {
+			t.Fatalf("Parse(%q) = %+v, want %+v", descriptor, got, want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		spec string
+		from string
+		want string
+	}{
+		{"* * * * *", "2024-01-01T10:00:00Z", "2024-01-01T10:01:00Z"},
+		{"* * * * *", "2024-01-01T10:00:59Z", "2024-01-01T10:01:00Z"},
+		{"*/15 * * * *", "2024-01-01T10:15:00Z", "2024-01-01T10:30:00Z"},
+		{"0 * * * *", "2024-01-01T10:59:00Z", "2024-01-01T11:00:00Z"},
+		{"30 9 * * *", "2024-01-01T09:30:00Z", "2024-01-02T09:30:00Z"},
+		{"0 0 1 * *", "2024-01-31T23:59:00Z", "2024-02-01T00:00:00Z"},
+		{"0 0 * * *", "2024-12-31T23:00:00Z", "2025-01-01T00:00:00Z"},
+		{"0 0 29 2 *", "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 0 31 * *", "2024-04-01T00:00:00Z", "2024-05-31T00:00:00Z"},
+		{"0 12 * * mon-fri", "2024-01-05T13:00:00Z", "2024-01-08T12:00:00Z"},
+		{"0 0 * * 7", "2024-01-01T00:00:00Z", "2024-01-07T00:00:00Z"},
+		// both days restricted: either one matches
+		{"0 0 13 * 5", "2024-01-01T00:00:00Z", "2024-01-05T00:00:00Z"},
+		{"0 0 13 * 5", "2024-01-12T00:00:00Z", "2024-01-13T00:00:00Z"},
+		// a stepped day of month still counts as unrestricted
+		{"0 0 */2 * 1", "2024-01-01T00:00:00Z", "2024-01-08T00:00:00Z"},
+		{"@yearly", "2024-06-15T08:00:00Z", "2025-01-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec+" after "+tt.from, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+			if got := s.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+				t.Fatalf("Next = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextUsesUTC(t *testing.T) {
+	s, _ := Parse("0 12 * * *")
+	from := time.Date(2024, 1, 1, 9, 0, 0, 0, time.FixedZone("UTC-5", -5*3600))
+
+	// 09:00 at UTC-5 is 14:00 UTC, past noon already
+	want := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	if got := s.Next(from); !got.Equal(want) {
+		t.Fatalf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestNextNeverFires(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Fatalf("Next = %s, want the zero time for 30 february", got)
+	}
+}
@@ -0,0 +1,160 @@
+package cron
+
+import (
+	"context"
+	"dtq/internal/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	jobPrefix   = "cron_job:"
+	statePrefix = "cron_state:"
+)
+
+// Job is a recurring task registered in etcd under cron_job:<name>
+type Job struct {
+	Name      string            `json:"name"`
+	Spec      string            `json:"spec"`
+	TaskType  string            `json:"task_type"`
+	Payload   []byte            `json:"payload,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// State is the firing state kept under cron_state:<name>. It lives in etcd and
+// not in the worker, so it survives the job moving to another owner
+type State struct {
+	LastRun    time.Time      `json:"last_run,omitzero"`
+	NextRun    time.Time      `json:"next_run"`
+	LastWorker types.WorkerID `json:"last_worker,omitempty"`
+}
+
+// Entry is a job with its state as read in one etcd snapshot
+type Entry struct {
+	Job   Job
+	State *State
+	// stateRev is the mod revision of the state key, 0 when there is no state yet
+	stateRev int64
+}
+
+type Store struct {
+	etcd *etcd.Client
+}
+
+func NewStore(etcdCli *etcd.Client) *Store {
+	return &Store{etcd: etcdCli}
+}
+
+func (s *Store) PutJob(ctx context.Context, job Job) error {
+	if strings.TrimSpace(job.Name) == "" {
+		return errors.New("cron: job name is required")
+	}
+	if job.TaskType == "" {
+		return errors.New("cron: task type is required")
+	}
+	if _, err := Parse(job.Spec); err != nil {
+		return err
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	// a changed spec must not keep the next run computed from the old one
+	_, err = s.etcd.Txn(ctx).Then(
+		etcd.OpPut(jobPrefix+job.Name, string(data)),
+		etcd.OpDelete(statePrefix+job.Name),
+	).Commit()
+	return err
+}
+
+func (s *Store) DeleteJob(ctx context.Context, name string) error {
+	resp, err := s.etcd.Txn(ctx).Then(
+		etcd.OpDelete(jobPrefix+name),
+		etcd.OpDelete(statePrefix+name),
+	).Commit()
+	if err != nil {
+		return err
+	}
+
+	if resp.Responses[0].GetResponseDeleteRange().Deleted == 0 {
+		return fmt.Errorf("cron: job %q not found", name)
+	}
+	return nil
+}
+
+// List reads every job and its state in a single request
+func (s *Store) List(ctx context.Context) ([]*Entry, error) {
+	resp, err := s.etcd.Get(ctx, "cron_", etcd.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*Entry)
+	states := make(map[string]*State)
+	stateRevs := make(map[string]int64)
+
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+
+		switch {
+		case strings.HasPrefix(key, jobPrefix):
+			var job Job
+			if err := json.Unmarshal(kv.Value, &job); err != nil {
+				return nil, fmt.Errorf("cron: bad job %s: %w", key, err)
+			}
+			entries[job.Name] = &Entry{Job: job}
+
+		case strings.HasPrefix(key, statePrefix):
+			var state State
+			if err := json.Unmarshal(kv.Value, &state); err != nil {
+				return nil, fmt.Errorf("cron: bad state %s: %w", key, err)
+			}
+			name := strings.TrimPrefix(key, statePrefix)
+			states[name] = &state
+			stateRevs[name] = kv.ModRevision
+		}
+	}
+
+	list := make([]*Entry, 0, len(entries))
+	for name, e := range entries {
+		e.State = states[name]
+		e.stateRev = stateRevs[name]
+		list = append(list, e)
+	}
+
+	return list, nil
+}
+
+// casState writes the state only if nobody changed it since e was read, so two
+// workers that both think they own the job cannot both advance it
+func (s *Store) casState(ctx context.Context, e *Entry, state State) (bool, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return false, err
+	}
+
+	key := statePrefix + e.Job.Name
+
+	cmp := etcd.Compare(etcd.ModRevision(key), "=", e.stateRev)
+	if e.stateRev == 0 {
+		cmp = etcd.Compare(etcd.CreateRevision(key), "=", 0)
+	}
+
+	resp, err := s.etcd.Txn(ctx).If(cmp).Then(etcd.OpPut(key, string(data))).Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Succeeded, nil
+}
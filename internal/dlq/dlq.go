@@ -0,0 +1,155 @@
+package dlq
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/queue"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrNotFound = errors.New("dlq: entry not found")
+
+// redriveScript only pushes the task back if this call removed the entry, two
+// concurrent redrives of the same entry enqueue it once
+var redriveScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call('RPUSH', KEYS[2], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// DLQ inspects and redrives the per partition dead letter lists
+type DLQ struct {
+	conn conn.IConn
+}
+
+type IDLQ interface {
+	Partitions(ctx context.Context) ([]types.PartitionID, error)
+	List(ctx context.Context, partition types.PartitionID, offset, limit int64) ([]*Entry, error)
+	Get(ctx context.Context, partition types.PartitionID, id string) (*Entry, error)
+	Delete(ctx context.Context, partition types.PartitionID, id string) error
+	Redrive(ctx context.Context, partition types.PartitionID, id string) error
+}
+
+func NewDLQ(conn conn.IConn) IDLQ {
+	return &DLQ{conn: conn}
+}
+
+// Partitions returns the partitions with at least one dead letter
+func (q *DLQ) Partitions(ctx context.Context) ([]types.PartitionID, error) {
+	partitions := make([]types.PartitionID, 0)
+
+	iter := q.conn.GetRedis().Scan(ctx, 0, "dlq:*", 100).Iterator()
+	for iter.Next(ctx) {
+		id, err := strconv.ParseUint(strings.TrimPrefix(iter.Val(), "dlq:"), 10, 32)
+		if err != nil {
+			continue
+		}
+		partitions = append(partitions, types.PartitionID(id))
+	}
+
+	slices.Sort(partitions)
+	return partitions, iter.Err()
+}
+
+// List returns entries newest first
+func (q *DLQ) List(ctx context.Context, partition types.PartitionID, offset, limit int64) ([]*Entry, error) {
+	raws, err := q.conn.GetRedis().LRange(ctx, queue.DeadLetterKey(partition), offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(raws))
+	for _, raw := range raws {
+		e, err := Unmarshal([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("dlq: bad entry in %s: %w", queue.DeadLetterKey(partition), err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func (q *DLQ) Get(ctx context.Context, partition types.PartitionID, id string) (*Entry, error) {
+	e, _, err := q.find(ctx, partition, id)
+	return e, err
+}
+
+func (q *DLQ) Delete(ctx context.Context, partition types.PartitionID, id string) error {
+	_, raw, err := q.find(ctx, partition, id)
+	if err != nil {
+		return err
+	}
+
+	removed, err := q.conn.GetRedis().LRem(ctx, queue.DeadLetterKey(partition), 1, raw).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Redrive pushes the task back to the tail of its original partition list with
+// its attempt count reset, so it gets a full retry policy again
+func (q *DLQ) Redrive(ctx context.Context, partition types.PartitionID, id string) error {
+	e, raw, err := q.find(ctx, partition, id)
+	if err != nil {
+		return err
+	}
+
+	taskRaw := e.Task
+	if t, err := task.Decode(e.Task); err == nil {
+		t.Attempt = 0
+		if encoded, err := task.CodecOf(e.Task).Encode(t); err == nil {
+			taskRaw = encoded
+		}
+	}
+
+	target := e.Queue
+	if target == "" {
+		target = queue.TaskKey(e.Partition)
+	}
+
+	moved, err := redriveScript.Run(ctx, q.conn.GetRedis(), []string{queue.DeadLetterKey(partition), target}, raw, taskRaw).Int()
+	if err != nil {
+		return err
+	}
+	if moved == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// find returns the entry and its raw value, needed to LREM it
+func (q *DLQ) find(ctx context.Context, partition types.PartitionID, id string) (*Entry, string, error) {
+	raws, err := q.conn.GetRedis().LRange(ctx, queue.DeadLetterKey(partition), 0, -1).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, raw := range raws {
+		e, err := Unmarshal([]byte(raw))
+		if err != nil {
+			continue
+		}
+		if e.ID == id {
+			return e, raw, nil
+		}
+	}
+
+	return nil, "", ErrNotFound
+}
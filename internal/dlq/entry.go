@@ -0,0 +1,90 @@
+package dlq
+
+import (
+	"dtq/internal/queue"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"encoding/json"
+	"time"
+)
+
+// failure reasons
+const (
+	ReasonRetriesExhausted = "retries_exhausted"
+	ReasonDecodeFailed     = "decode_failed"
+	ReasonEncodeFailed     = "encode_failed"
+)
+
+// Entry is what lands in dlq:N. Task keeps the raw bytes of the task as they
+// were delivered, so a redrive pushes back exactly what the producer wrote
+type Entry struct {
+	ID         string            `json:"id"`
+	Partition  types.PartitionID `json:"partition"`
+	Queue      string            `json:"queue"`
+	Task       []byte            `json:"task"`
+	TaskID     string            `json:"task_id,omitempty"`
+	TaskType   string            `json:"task_type,omitempty"`
+	Attempts   int               `json:"attempts"`
+	Reason     string            `json:"reason"`
+	LastError  string            `json:"last_error"`
+	WorkerID   types.WorkerID    `json:"worker_id"`
+	EnqueuedAt time.Time         `json:"enqueued_at,omitzero"`
+	FailedAt   time.Time         `json:"failed_at"`
+}
+
+// NewEntry builds the entry of a delivery. t is nil when the task could not be decoded
+func NewEntry(partition types.PartitionID, queue string, raw []byte, t *task.Task, reason string, lastErr error, workerID types.WorkerID) *Entry {
+	e := &Entry{
+		ID:        task.NewID(),
+		Partition: partition,
+		Queue:     queue,
+		Task:      raw,
+		Reason:    reason,
+		WorkerID:  workerID,
+		FailedAt:  time.Now().UTC(),
+	}
+
+	if lastErr != nil {
+		e.LastError = lastErr.Error()
+	}
+
+	if t != nil {
+		e.TaskID = t.ID
+		e.TaskType = t.Type
+		e.Attempts = t.Attempt
+		e.EnqueuedAt = t.EnqueuedAt
+	}
+
+	return e
+}
+
+func (e *Entry) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func Unmarshal(data []byte) (*Entry, error) {
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Relocate rewrites a raw entry for the partition route maps its task to, after
+// a resize. The entry keeps the priority list it came from
+func Relocate(raw []byte, route queue.Router) (types.PartitionID, []byte) {
+	e, err := Unmarshal(raw)
+	if err != nil {
+		// unreadable entries still leave the retired partition, routed by their bytes
+		return route(raw), raw
+	}
+
+	e.Partition = route(e.Task)
+	e.Queue = queue.PriorityKey(queue.TaskKey(e.Partition), queue.PriorityFromKey(e.Queue))
+
+	data, err := e.Marshal()
+	if err != nil {
+		return route(raw), raw
+	}
+	return e.Partition, data
+}
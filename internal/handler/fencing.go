@@ -0,0 +1,19 @@
+package handler
+
+import "context"
+
+type fencingTokenKey struct{}
+
+// WithFencingToken returns a ctx carrying the fencing token of the partition
+// claim the task was fetched under
+func WithFencingToken(ctx context.Context, token int64) context.Context {
+	return context.WithValue(ctx, fencingTokenKey{}, token)
+}
+
+// FencingToken is the token handlers should pass along with side effects, so
+// the systems they write to can reject a worker that lost the partition
+// (keep the highest token seen, refuse smaller ones). Zero when not fenced
+func FencingToken(ctx context.Context) int64 {
+	token, _ := ctx.Value(fencingTokenKey{}).(int64)
+	return token
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"dtq/internal/retry"
+	"dtq/internal/task"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+var ErrUnknownTaskType = errors.New("handler: unknown task type")
+
+// HandlerFunc processes one task. Returning an error marks the task as failed
+type HandlerFunc func(ctx context.Context, t task.Task) error
+
+type entry struct {
+	fn     HandlerFunc
+	policy retry.Policy
+}
+
+type RegisterOption func(e *entry)
+
+// WithRetryPolicy overrides the registry default retry policy for one task type
+func WithRetryPolicy(p retry.Policy) RegisterOption {
+	return func(e *entry) {
+		e.policy = p
+	}
+}
+
+type HandlerRegistry struct {
+	handlers      map[string]entry
+	defaultPolicy retry.Policy
+
+	mu sync.RWMutex
+}
+
+type IHandlerRegistry interface {
+	Register(taskType string, fn HandlerFunc, opts ...RegisterOption)
+	Handle(ctx context.Context, t task.Task) error
+	RetryPolicy(taskType string) retry.Policy
+	TaskTypes() []string
+}
+
+func NewHandlerRegistry() IHandlerRegistry {
+	return &HandlerRegistry{
+		handlers:      map[string]entry{},
+		defaultPolicy: retry.DefaultPolicy(),
+	}
+}
+
+// Register panics on an empty type, a nil handler or a type registered twice,
+// those are programming errors that should fail at startup
+func (r *HandlerRegistry) Register(taskType string, fn HandlerFunc, opts ...RegisterOption) {
+	if taskType == "" {
+		panic("handler: empty task type")
+	}
+	if fn == nil {
+		panic("handler: nil handler for " + taskType)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.handlers[taskType]; ok {
+		panic("handler: task type registered twice: " + taskType)
+	}
+
+	e := entry{fn: fn, policy: r.defaultPolicy}
+	for _, opt := range opts {
+		opt(&e)
+	}
+
+	r.handlers[taskType] = e
+}
+
+// Handle dispatches the task to the handler of its type. A panicking handler is
+// reported as a failure instead of taking the worker down
+func (r *HandlerRegistry) Handle(ctx context.Context, t task.Task) (err error) {
+	r.mu.RLock()
+	e, ok := r.handlers[t.Type]
+	r.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownTaskType, t.Type)
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("handler: panic handling %s: %v", t.String(), rec)
+		}
+	}()
+
+	return e.fn(ctx, t)
+}
+
+// RetryPolicy of the task type. Unknown types get the default policy, the
+// handler may be registered on a worker that is not rolled out yet
+func (r *HandlerRegistry) RetryPolicy(taskType string) retry.Policy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if e, ok := r.handlers[taskType]; ok {
+		return e.policy
+	}
+	return r.defaultPolicy
+}
+
+func (r *HandlerRegistry) TaskTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.handlers))
+	for taskType := range r.handlers {
+		types = append(types, taskType)
+	}
+	slices.Sort(types)
+
+	return types
+}
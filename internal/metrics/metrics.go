@@ -8,20 +8,53 @@ import (
 	"time"
 )
 
+// handoff phases, both measured from the rebalance that moved the partition
+const (
+	// HandoffRelease is the losing owner draining a partition until it is published as released
+	HandoffRelease = "release"
+	// HandoffAcquire is the gaining owner waiting until it holds the partition
+	HandoffAcquire = "acquire"
+)
+
 type Metrics struct {
-	ProcessedTasks   uint64
-	RebalancingCount uint64
-	TotalPartitions  uint64
-	WorkerID         types.WorkerID
-	LogInterval      time.Duration
+	ProcessedTasks    uint64
+	FailedTasks       uint64
+	RetriedTasks      uint64
+	DeadLettered      uint64
+	InFlight          int64
+	RebalancingCount  uint64
+	SuppressedCount   uint64
+	RecoveredTasks    uint64
+	FencedTasks       uint64
+	MigratedTasks     uint64
+	LeaseLosses       uint64
+	WatchRestarts     uint64
+	TotalPartitions   uint64
+	StandbyPartitions uint64
+	WorkerID          types.WorkerID
+	LogInterval       time.Duration
 
 	mu sync.RWMutex
 }
 
 type IMetrics interface {
 	IncrTask()
+	IncrFailedTask(taskType string)
+	IncrRetry(taskType string)
+	ObserveAttempts(taskType string, attempts int)
+	IncrDeadLettered(reason string)
+	AddInFlight(delta int64)
 	IncrRebalancing()
+	IncrSuppressedRebalances(amount uint64)
+	IncrRecovered(amount uint64)
+	IncrFenced()
+	IncrMigrated(amount uint64)
+	IncrLeaseLost()
+	SetWatchHealthy(watch string, healthy bool)
+	IncrWatchRestarts(watch string, reason string)
+	ObserveHandoff(phase string, latency time.Duration)
 	SetPartitions(amount uint64)
+	SetStandbyPartitions(amount uint64)
 	SetWorkerID(id types.WorkerID)
 	DoMonitor()
 }
@@ -54,6 +87,51 @@ func (m *Metrics) IncrTask() {
 	observability.TasksProcessedTotal.WithLabelValues(workerID).Inc()
 }
 
+func (m *Metrics) IncrFailedTask(taskType string) {
+	m.mu.Lock()
+	m.FailedTasks++
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	if taskType == "" {
+		taskType = "unknown"
+	}
+
+	observability.TasksFailedTotal.WithLabelValues(workerID, taskType).Inc()
+}
+
+func (m *Metrics) IncrRetry(taskType string) {
+	m.mu.Lock()
+	m.RetriedTasks++
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.TaskRetriesTotal.WithLabelValues(workerID, taskType).Inc()
+}
+
+// ObserveAttempts records how many runs a task needed once it is done for good
+func (m *Metrics) ObserveAttempts(taskType string, attempts int) {
+	observability.TaskAttempts.WithLabelValues(taskType).Observe(float64(attempts))
+}
+
+func (m *Metrics) IncrDeadLettered(reason string) {
+	m.mu.Lock()
+	m.DeadLettered++
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.TasksDeadLetteredTotal.WithLabelValues(workerID, reason).Inc()
+}
+
+func (m *Metrics) AddInFlight(delta int64) {
+	m.mu.Lock()
+	m.InFlight += delta
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.TasksInFlight.WithLabelValues(workerID).Add(float64(delta))
+}
+
 func (m *Metrics) IncrRebalancing() {
 	m.mu.Lock()
 	m.RebalancingCount++
@@ -63,6 +141,85 @@ func (m *Metrics) IncrRebalancing() {
 	observability.RebalancesTotal.WithLabelValues(workerID).Inc()
 }
 
+// IncrSuppressedRebalances counts membership events folded into another rebalance
+func (m *Metrics) IncrSuppressedRebalances(amount uint64) {
+	m.mu.Lock()
+	m.SuppressedCount += amount
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.RebalancesSuppressedTotal.WithLabelValues(workerID).Add(float64(amount))
+}
+
+func (m *Metrics) IncrRecovered(amount uint64) {
+	m.mu.Lock()
+	m.RecoveredTasks += amount
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.TasksRecoveredTotal.WithLabelValues(workerID).Add(float64(amount))
+}
+
+// IncrFenced counts deliveries a stale partition owner could not settle
+func (m *Metrics) IncrFenced() {
+	m.mu.Lock()
+	m.FencedTasks++
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.TasksFencedTotal.WithLabelValues(workerID).Inc()
+}
+
+// IncrMigrated counts tasks moved from a retired partition layout to the current one
+func (m *Metrics) IncrMigrated(amount uint64) {
+	m.mu.Lock()
+	m.MigratedTasks += amount
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.TasksMigratedTotal.WithLabelValues(workerID).Add(float64(amount))
+}
+
+// IncrLeaseLost counts the times the worker lease expired while it was running
+func (m *Metrics) IncrLeaseLost() {
+	m.mu.Lock()
+	m.LeaseLosses++
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.LeaseLossesTotal.WithLabelValues(workerID).Inc()
+}
+
+// SetWatchHealthy records whether the named etcd watch is streaming
+func (m *Metrics) SetWatchHealthy(watch string, healthy bool) {
+	m.mu.RLock()
+	workerID := string(m.WorkerID)
+	m.mu.RUnlock()
+
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	observability.WatchHealthy.WithLabelValues(workerID, watch).Set(value)
+}
+
+func (m *Metrics) IncrWatchRestarts(watch string, reason string) {
+	m.mu.Lock()
+	m.WatchRestarts++
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.WatchRestartsTotal.WithLabelValues(workerID, watch, reason).Inc()
+}
+
+func (m *Metrics) ObserveHandoff(phase string, latency time.Duration) {
+	m.mu.RLock()
+	workerID := string(m.WorkerID)
+	m.mu.RUnlock()
+
+	observability.PartitionHandoffSeconds.WithLabelValues(workerID, phase).Observe(latency.Seconds())
+}
+
 func (m *Metrics) SetPartitions(amount uint64) {
 	m.mu.Lock()
 	m.TotalPartitions = amount
@@ -72,14 +229,36 @@ func (m *Metrics) SetPartitions(amount uint64) {
 	observability.PartitionsOwned.WithLabelValues(workerID).Set(float64(amount))
 }
 
+// SetStandbyPartitions records how many partitions fail over to this worker
+// if the zone of their owner is lost
+func (m *Metrics) SetStandbyPartitions(amount uint64) {
+	m.mu.Lock()
+	m.StandbyPartitions = amount
+	workerID := string(m.WorkerID)
+	m.mu.Unlock()
+
+	observability.PartitionsStandby.WithLabelValues(workerID).Set(float64(amount))
+}
+
 func (m *Metrics) DoMonitor() {
 	ticker := time.NewTicker(m.LogInterval)
 	for range ticker.C {
 		m.mu.RLock()
 		slog.Info("[METRICS]",
 			"Processed Tasks", m.ProcessedTasks,
+			"Failed Tasks", m.FailedTasks,
+			"Retried Tasks", m.RetriedTasks,
+			"Dead Lettered", m.DeadLettered,
+			"In Flight", m.InFlight,
 			"Rebalancing Count", m.RebalancingCount,
+			"Suppressed Rebalances", m.SuppressedCount,
+			"Recovered Tasks", m.RecoveredTasks,
+			"Fenced Tasks", m.FencedTasks,
+			"Migrated Tasks", m.MigratedTasks,
+			"Lease Losses", m.LeaseLosses,
+			"Watch Restarts", m.WatchRestarts,
 			"Total Partitions", m.TotalPartitions,
+			"Standby Partitions", m.StandbyPartitions,
 		)
 		m.mu.RUnlock()
 	}
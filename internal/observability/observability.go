@@ -13,21 +13,93 @@ var (
 		Name: "dtq_tasks_processed_total",
 		Help: "Total tasks processed by worker",
 	}, []string{"worker_id"})
+	TasksFailedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtq_tasks_failed_total",
+		Help: "Total tasks whose handler failed or that could not be dispatched",
+	}, []string{"worker_id", "task_type"})
+	TaskRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtq_task_retries_total",
+		Help: "Total failed tasks scheduled for another attempt",
+	}, []string{"worker_id", "task_type"})
+	TaskAttempts = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dtq_task_attempts",
+		Help:    "Attempts a task needed before succeeding or exhausting its retries",
+		Buckets: []float64{1, 2, 3, 5, 8, 13, 21},
+	}, []string{"task_type"})
+	TasksDeadLetteredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtq_tasks_dead_lettered_total",
+		Help: "Total tasks moved to a dead letter list",
+	}, []string{"worker_id", "reason"})
+	TasksInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dtq_tasks_in_flight",
+		Help: "Tasks currently being handled by worker",
+	}, []string{"worker_id"})
 	PartitionsOwned = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "dtq_partitions_owned",
 		Help: "Total partitions owned by worker",
 	}, []string{"worker_id"})
+	PartitionsStandby = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dtq_partitions_standby",
+		Help: "Partitions the worker is standby owner of, in another zone than their owner",
+	}, []string{"worker_id"})
 	RebalancesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "dtq_rebalances_total",
 		Help: "Total consistent hashing rebalances",
 	}, []string{"worker_id"})
+	RebalancesSuppressedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtq_rebalances_suppressed_total",
+		Help: "Total membership events coalesced into another rebalance",
+	}, []string{"worker_id"})
+	TasksRecoveredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtq_tasks_recovered_total",
+		Help: "Total in-flight tasks of dead workers returned to their partition",
+	}, []string{"worker_id"})
+	TasksFencedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtq_tasks_fenced_total",
+		Help: "Total deliveries rejected because the partition has a newer owner",
+	}, []string{"worker_id"})
+	TasksMigratedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtq_tasks_migrated_total",
+		Help: "Total tasks moved from a retired partition layout to the current one",
+	}, []string{"worker_id"})
+	LeaseLossesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtq_lease_losses_total",
+		Help: "Total times the worker lease expired and the worker registered again",
+	}, []string{"worker_id"})
+	WatchHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dtq_watch_healthy",
+		Help: "Whether an etcd watch of the worker is streaming (1) or being restarted (0)",
+	}, []string{"worker_id", "watch"})
+	WatchRestartsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtq_watch_restarts_total",
+		Help: "Total etcd watch restarts by reason (compacted, canceled, closed, list)",
+	}, []string{"worker_id", "watch", "reason"})
+	PartitionHandoffSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dtq_partition_handoff_seconds",
+		Help:    "Time from a rebalance until a moved partition is released (release) or claimed (acquire)",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"worker_id", "phase"})
 )
 
 func InitPrometheus() *prometheus.Registry {
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(TasksProcessedTotal)
+	reg.MustRegister(TasksFailedTotal)
+	reg.MustRegister(TaskRetriesTotal)
+	reg.MustRegister(TaskAttempts)
+	reg.MustRegister(TasksDeadLetteredTotal)
+	reg.MustRegister(TasksInFlight)
 	reg.MustRegister(PartitionsOwned)
+	reg.MustRegister(PartitionsStandby)
 	reg.MustRegister(RebalancesTotal)
+	reg.MustRegister(RebalancesSuppressedTotal)
+	reg.MustRegister(TasksRecoveredTotal)
+	reg.MustRegister(TasksFencedTotal)
+	reg.MustRegister(TasksMigratedTotal)
+	reg.MustRegister(LeaseLossesTotal)
+	reg.MustRegister(WatchHealthy)
+	reg.MustRegister(WatchRestartsTotal)
+	reg.MustRegister(PartitionHandoffSeconds)
 	return reg
 }
 
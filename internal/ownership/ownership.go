@@ -0,0 +1,273 @@
+package ownership
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/queue"
+	"dtq/internal/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	ownerPrefix    = "partition_owner:"
+	releasedPrefix = "partition_released:"
+)
+
+var errWatchClosed = errors.New("ownership: owner watch closed")
+
+// OwnerKey is the etcd key a worker holds, under its lease, while it consumes a partition
+func OwnerKey(partition types.PartitionID) string {
+	return fmt.Sprintf("%s%d", ownerPrefix, partition)
+}
+
+// ReleasedKey is where the last owner of a partition publishes that it drained
+// it. The next claim consumes the record
+func ReleasedKey(partition types.PartitionID) string {
+	return fmt.Sprintf("%s%d", releasedPrefix, partition)
+}
+
+// Released is the record published by an owner handing a partition over
+type Released struct {
+	WorkerID   types.WorkerID `json:"worker_id"`
+	Token      int64          `json:"token"`
+	ReleasedAt time.Time      `json:"released_at"`
+}
+
+// Claim is a partition taken by Claim
+type Claim struct {
+	Partition types.PartitionID
+	Token     int64
+	// Released is what the previous owner published, nil when it never released
+	// the partition (lease expired) or when we already held it
+	Released *Released
+	// New is false when we already held and consumed the partition
+	New bool
+}
+
+// Manager claims partitions in etcd. The ring says which partitions a worker
+// should own, but workers apply membership changes at different moments, so a
+// partition is only consumed once its owner key is ours.
+//
+// The fencing token of a claim is the etcd revision that created the key: every
+// new claim of a partition gets a bigger token than all the previous ones
+type Manager struct {
+	conn     conn.IConn
+	workerID types.WorkerID
+	lease    func() etcd.LeaseID
+
+	tokens map[types.PartitionID]int64
+	// revision is the etcd revision of the last claim attempt, Await starts from it
+	revision int64
+	mu       sync.RWMutex
+}
+
+type IManager interface {
+	// Claim tries to take every partition and returns the ones held by us. An
+	// error on one partition does not stop the others, the errors are joined
+	Claim(ctx context.Context, partitions []types.PartitionID) ([]Claim, error)
+	// Release deletes our owner keys and publishes the partitions as released
+	Release(ctx context.Context, partitions []types.PartitionID)
+	// Await blocks until one of the partitions has no owner anymore
+	Await(ctx context.Context, partitions []types.PartitionID) error
+	// Drop forgets every claim without touching etcd, once the lease they were
+	// held under is lost
+	Drop()
+	Token(partition types.PartitionID) (int64, bool)
+	Held() []types.PartitionID
+}
+
+func NewManager(conn conn.IConn, workerID types.WorkerID, lease func() etcd.LeaseID) IManager {
+	return &Manager{
+		conn:     conn,
+		workerID: workerID,
+		lease:    lease,
+		tokens:   map[types.PartitionID]int64{},
+	}
+}
+
+func (m *Manager) Claim(ctx context.Context, partitions []types.PartitionID) ([]Claim, error) {
+	claims := make([]Claim, 0, len(partitions))
+	var errs []error
+
+	for _, partitionID := range partitions {
+		claim, ok, err := m.claim(ctx, partitionID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("partition %d: %w", partitionID, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		// raise the redis fence before consuming, from now on settling with an
+		// older token is rejected. On error the owner key stays ours but is not
+		// consumed, the next claim finds it and raises the fence again
+		if err := queue.RaiseFence(ctx, m.conn.GetRedis(), partitionID, claim.Token); err != nil {
+			errs = append(errs, fmt.Errorf("partition %d: %w", partitionID, err))
+			continue
+		}
+
+		m.mu.Lock()
+		m.tokens[partitionID] = claim.Token
+		m.mu.Unlock()
+
+		claims = append(claims, claim)
+	}
+
+	return claims, errors.Join(errs...)
+}
+
+func (m *Manager) claim(ctx context.Context, partitionID types.PartitionID) (Claim, bool, error) {
+	key := OwnerKey(partitionID)
+	released := ReleasedKey(partitionID)
+
+	resp, err := m.conn.GetEtcd().Txn(ctx).
+		If(etcd.Compare(etcd.CreateRevision(key), "=", 0)).
+		Then(
+			etcd.OpPut(key, string(m.workerID), etcd.WithLease(m.lease())),
+			etcd.OpGet(released),
+			etcd.OpDelete(released),
+		).
+		Else(etcd.OpGet(key)).
+		Commit()
+	if err != nil {
+		return Claim{}, false, err
+	}
+
+	m.mu.Lock()
+	m.revision = max(m.revision, resp.Header.Revision)
+	m.mu.Unlock()
+
+	claim := Claim{Partition: partitionID}
+
+	if resp.Succeeded {
+		claim.Token = resp.Header.Revision
+		claim.New = true
+
+		if kvs := resp.Responses[1].GetResponseRange().Kvs; len(kvs) == 1 {
+			var r Released
+			if json.Unmarshal(kvs[0].Value, &r) == nil {
+				claim.Released = &r
+			}
+		}
+		return claim, true, nil
+	}
+
+	// the key is already ours, it is new to us if an earlier claim of it
+	// failed before we started consuming it
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) == 1 && string(kvs[0].Value) == string(m.workerID) {
+		_, held := m.Token(partitionID)
+		claim.Token = kvs[0].CreateRevision
+		claim.New = !held
+		return claim, true, nil
+	}
+
+	return claim, false, nil
+}
+
+// Release deletes our owner keys, only if they are still ours, and publishes
+// the release in the same transaction. Callers release a partition once its
+// in-flight tasks are finished or returned
+func (m *Manager) Release(ctx context.Context, partitions []types.PartitionID) {
+	for _, partitionID := range partitions {
+		key := OwnerKey(partitionID)
+		token, _ := m.Token(partitionID)
+
+		record, err := json.Marshal(Released{
+			WorkerID:   m.workerID,
+			Token:      token,
+			ReleasedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			continue
+		}
+
+		_, err = m.conn.GetEtcd().Txn(ctx).
+			If(etcd.Compare(etcd.Value(key), "=", string(m.workerID))).
+			Then(
+				etcd.OpDelete(key),
+				etcd.OpPut(ReleasedKey(partitionID), string(record)),
+			).
+			Commit()
+		if err != nil {
+			// the key goes away with our lease anyway
+			continue
+		}
+
+		m.mu.Lock()
+		delete(m.tokens, partitionID)
+		m.mu.Unlock()
+	}
+}
+
+// Await watches the owner keys from the last claim attempt, so a release that
+// happened right after it is not missed. A compacted or broken watch returns
+// an error, callers claim again to get a fresh revision
+func (m *Manager) Await(ctx context.Context, partitions []types.PartitionID) error {
+	m.mu.RLock()
+	revision := m.revision
+	m.mu.RUnlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	watchCh := m.conn.GetEtcd().Watch(ctx, ownerPrefix,
+		etcd.WithPrefix(), etcd.WithRev(revision+1), etcd.WithFilterPut())
+
+	for watchResp := range watchCh {
+		if err := watchResp.Err(); err != nil {
+			return err
+		}
+
+		for _, event := range watchResp.Events {
+			var partitionID types.PartitionID
+			if _, err := fmt.Sscanf(string(event.Kv.Key), ownerPrefix+"%d", &partitionID); err != nil {
+				continue
+			}
+			if slices.Contains(partitions, partitionID) {
+				return nil
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errWatchClosed
+}
+
+func (m *Manager) Token(partition types.PartitionID) (int64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.tokens[partition]
+	return token, ok
+}
+
+func (m *Manager) Held() []types.PartitionID {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	held := make([]types.PartitionID, 0, len(m.tokens))
+	for partitionID := range m.tokens {
+		held = append(held, partitionID)
+	}
+	slices.Sort(held)
+
+	return held
+}
+
+func (m *Manager) Drop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokens = map[types.PartitionID]int64{}
+}
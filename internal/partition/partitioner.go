@@ -0,0 +1,61 @@
+package partition
+
+import (
+	"crypto/sha256"
+	"dtq/internal/types"
+	"encoding/binary"
+	"math/bits"
+)
+
+// IPartitioner maps a task partition key to its partition. Producers and
+// workers must use the same implementation or tasks land on partitions
+// nobody expects them on
+type IPartitioner interface {
+	Partition(key string) types.PartitionID
+	Count() int
+}
+
+type SHA256Partitioner struct {
+	first types.PartitionID
+	count int
+}
+
+// NewSHA256Partitioner spreads keys over count partitions, count must be the
+// cluster partition count (see internal/cluster)
+func NewSHA256Partitioner(count int) IPartitioner {
+	return NewRangePartitioner(0, count)
+}
+
+// NewRangePartitioner spreads keys over the partitions [first, first+count),
+// the ids of a cluster layout after a resize
+func NewRangePartitioner(first types.PartitionID, count int) IPartitioner {
+	return SHA256Partitioner{first: first, count: max(count, 1)}
+}
+
+// Partition scales the first 8 bytes of sha256(key) to the partition range,
+// floor(h * count / 2^64). With 256 partitions it is the first byte of the
+// hash, the rule producers used before the count was configurable
+func (p SHA256Partitioner) Partition(key string) types.PartitionID {
+	hash := sha256.Sum256([]byte(key))
+	partition, _ := bits.Mul64(binary.BigEndian.Uint64(hash[:8]), uint64(p.count))
+	return p.first + types.PartitionID(partition)
+}
+
+func (p SHA256Partitioner) Count() int {
+	return p.count
+}
+
+// ITypeRouter is a partitioner that also picks partitions by task type: task
+// types routed to the workers supporting them have partitions of their own
+type ITypeRouter interface {
+	IPartitioner
+	PartitionFor(taskType, key string) types.PartitionID
+}
+
+// For picks the partition of a task, through the task type when p routes types
+func For(p IPartitioner, taskType, key string) types.PartitionID {
+	if router, ok := p.(ITypeRouter); ok {
+		return router.PartitionFor(taskType, key)
+	}
+	return p.Partition(key)
+}
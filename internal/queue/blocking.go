@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/types"
+	"time"
+)
+
+// BlockingQueue pops tasks with BLPOP. A task is gone from redis as soon as it
+// is popped, so a crash before it is handled loses it (at-most-once)
+type BlockingQueue struct {
+	conn  conn.IConn
+	order *keyOrder
+}
+
+func NewBlockingQueue(conn conn.IConn, priorities PriorityPolicy) IQueue {
+	return &BlockingQueue{
+		conn:  conn,
+		order: &keyOrder{policy: priorities},
+	}
+}
+
+func (q *BlockingQueue) Fetch(ctx context.Context, partitions []types.PartitionID) (*Delivery, error) {
+	// BLPOP serves the first non empty key, so the key order is the priority order
+	res, err := q.conn.GetRedis().BLPop(ctx, 0, q.order.keys(partitions)...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return newDelivery(res[0], res[1]), nil
+}
+
+// Ack has nothing to remove, it only checks the fence so a stale owner learns
+// its result is not the one that counts
+func (q *BlockingQueue) Ack(ctx context.Context, d *Delivery) error {
+	if d.Token == 0 {
+		return nil
+	}
+	return settle(ctx, q.conn.GetRedis(), d, "", settleAck, "", nil, 0)
+}
+
+func (q *BlockingQueue) Requeue(ctx context.Context, d *Delivery, raw []byte) error {
+	return settle(ctx, q.conn.GetRedis(), d, "", settleRequeue, d.Source, raw, 0)
+}
+
+func (q *BlockingQueue) Forward(ctx context.Context, d *Delivery, target types.PartitionID) error {
+	return settle(ctx, q.conn.GetRedis(), d, "", settleRequeue, PriorityKey(TaskKey(target), d.Priority), []byte(d.Raw), 0)
+}
+
+func (q *BlockingQueue) Retry(ctx context.Context, d *Delivery, raw []byte, due time.Time) error {
+	return settle(ctx, q.conn.GetRedis(), d, "", settleRetry, PriorityKey(RetryKey(d.Partition), d.Priority), raw, due.UnixMilli())
+}
+
+func (q *BlockingQueue) DeadLetter(ctx context.Context, d *Delivery, entry []byte) error {
+	return settle(ctx, q.conn.GetRedis(), d, "", settleDead, DeadLetterKey(d.Partition), entry, 0)
+}
+
+func (q *BlockingQueue) Recover(ctx context.Context, alive map[types.WorkerID]bool) (int, error) {
+	return 0, nil
+}
+
+func (q *BlockingQueue) RecoverWorker(ctx context.Context, workerID types.WorkerID, partition types.PartitionID) (int, error) {
+	return 0, nil
+}
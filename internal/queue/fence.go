@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"dtq/internal/types"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrStaleOwner is returned when a delivery is settled with a fencing token
+// older than the partition fence: another worker owns the partition now. The
+// original task is handed back to its list, the new owner will run it
+var ErrStaleOwner = errors.New("queue: partition has a newer owner")
+
+// FenceKey holds the highest fencing token that claimed a partition
+func FenceKey(partition types.PartitionID) string {
+	return fmt.Sprintf("partition_fence:%d", partition)
+}
+
+// raiseFenceScript only ever moves the fence forward, a slow old owner raising
+// it late cannot lock out the current one
+var raiseFenceScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local token = tonumber(ARGV[1])
+if token > current then
+	redis.call('SET', KEYS[1], ARGV[1])
+	return token
+end
+return current
+`)
+
+// RaiseFence sets the partition fence to token unless it is already higher
+func RaiseFence(ctx context.Context, rdb *redis.Client, partition types.PartitionID, token int64) error {
+	return raiseFenceScript.Run(ctx, rdb, []string{FenceKey(partition)}, token).Err()
+}
+
+// settleScript checks the fence and settles a delivery in one step.
+//
+// KEYS: fence, processing list, source list, target
+// ARGV: token, raw delivery, op, payload, score
+//
+// op is ack, requeue (LPUSH payload to target), retry (ZADD payload to target)
+// or dead (LPUSH payload to target). An empty processing key means the task is
+// not kept in-flight (blocking queue). A zero token is not fenced.
+//
+// A stale token settles nothing: the raw delivery goes back to the head of its
+// source list and 0 is returned
+var settleScript = redis.NewScript(`
+local token = tonumber(ARGV[1])
+local fence = tonumber(redis.call('GET', KEYS[1]) or '0')
+
+if token > 0 and token < fence then
+	if KEYS[2] ~= '' then
+		redis.call('LREM', KEYS[2], 1, ARGV[2])
+	end
+	redis.call('LPUSH', KEYS[3], ARGV[2])
+	return 0
+end
+
+if KEYS[2] ~= '' then
+	redis.call('LREM', KEYS[2], 1, ARGV[2])
+end
+
+local op = ARGV[3]
+if op == 'requeue' or op == 'dead' then
+	redis.call('LPUSH', KEYS[4], ARGV[4])
+elseif op == 'retry' then
+	redis.call('ZADD', KEYS[4], ARGV[5], ARGV[4])
+end
+return 1
+`)
+
+const (
+	settleAck     = "ack"
+	settleRequeue = "requeue"
+	settleRetry   = "retry"
+	settleDead    = "dead"
+)
+
+// settle runs settleScript for d. processing is empty when the queue keeps no
+// in-flight list
+func settle(ctx context.Context, rdb *redis.Client, d *Delivery, processing, op, target string, payload []byte, score int64) error {
+	keys := []string{FenceKey(d.Partition), processing, d.Source, target}
+
+	settled, err := settleScript.Run(ctx, rdb, keys, d.Token, d.Raw, op, payload, score).Int()
+	if err != nil {
+		return err
+	}
+	if settled == 0 {
+		return ErrStaleOwner
+	}
+	return nil
+}
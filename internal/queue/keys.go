@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"dtq/internal/types"
+	"fmt"
+	"strings"
+)
+
+const processingPrefix = "processing:"
+
+// TaskKey is the redis list holding pending tasks for a partition
+func TaskKey(partition types.PartitionID) string {
+	return fmt.Sprintf("tasks:%d", partition)
+}
+
+// RetryKey is the sorted set of failed tasks of a partition waiting for their
+// next attempt, scored by due time in unix millis
+func RetryKey(partition types.PartitionID) string {
+	return fmt.Sprintf("retry:%d", partition)
+}
+
+// DelayedKey is the sorted set of tasks of a partition scheduled for later,
+// scored by due time in unix millis
+func DelayedKey(partition types.PartitionID) string {
+	return fmt.Sprintf("delayed:%d", partition)
+}
+
+// DeadLetterKey is the list of tasks of a partition that will not be retried anymore
+func DeadLetterKey(partition types.PartitionID) string {
+	return fmt.Sprintf("dlq:%d", partition)
+}
+
+// ProcessingKey is the in-flight list of a worker for one source list.
+// the source list is kept as the key suffix so a reaper knows where to return tasks
+func ProcessingKey(workerID types.WorkerID, source string) string {
+	return fmt.Sprintf("%s%s:%s", processingPrefix, workerID, source)
+}
+
+// parseProcessingKey splits processing:<worker>:<source> back into its parts
+func parseProcessingKey(key string) (types.WorkerID, string, bool) {
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) < 3 || parts[0]+":" != processingPrefix {
+		return "", "", false
+	}
+
+	return types.WorkerID(parts[1]), parts[2], true
+}
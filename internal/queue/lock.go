@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/types"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript takes the partition lock (or extends it if we already hold it)
+// and records us as the last holder, returning the previous one so the new
+// holder can recover what a crashed holder left in-flight
+var acquireScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return {1, ARGV[1]}
+end
+if holder then
+	return {0, holder}
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+local previous = redis.call('GET', KEYS[2]) or ''
+redis.call('SET', KEYS[2], ARGV[1])
+return {1, previous}
+`)
+
+var refreshScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// PartitionLocker gives a single consumer per partition. The lock expires after
+// ttl unless refreshed, so a crashed holder does not block the partition forever
+type PartitionLocker struct {
+	conn     conn.IConn
+	workerID types.WorkerID
+	ttl      time.Duration
+}
+
+func NewPartitionLocker(conn conn.IConn, workerID types.WorkerID, ttl time.Duration) *PartitionLocker {
+	return &PartitionLocker{
+		conn:     conn,
+		workerID: workerID,
+		ttl:      ttl,
+	}
+}
+
+func lockKey(partition types.PartitionID) string {
+	return fmt.Sprintf("partition_lock:%d", partition)
+}
+
+func holderKey(partition types.PartitionID) string {
+	return fmt.Sprintf("partition_holder:%d", partition)
+}
+
+// Acquire returns whether the lock was taken and the worker that held it before
+func (l *PartitionLocker) Acquire(ctx context.Context, partition types.PartitionID) (bool, types.WorkerID, error) {
+	res, err := acquireScript.Run(ctx, l.conn.GetRedis(),
+		[]string{lockKey(partition), holderKey(partition)},
+		string(l.workerID), l.ttl.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return false, "", err
+	}
+
+	acquired, _ := res[0].(int64)
+	previous, _ := res[1].(string)
+
+	return acquired == 1, types.WorkerID(previous), nil
+}
+
+// Refresh extends the lock, false means it was lost
+func (l *PartitionLocker) Refresh(ctx context.Context, partition types.PartitionID) (bool, error) {
+	n, err := refreshScript.Run(ctx, l.conn.GetRedis(), []string{lockKey(partition)}, string(l.workerID), l.ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (l *PartitionLocker) Release(ctx context.Context, partition types.PartitionID) error {
+	return releaseScript.Run(ctx, l.conn.GetRedis(), []string{lockKey(partition)}, string(l.workerID)).Err()
+}
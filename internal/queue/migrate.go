@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/types"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// migrateListScript moves a member taken into the in-flight list to the head
+// of its new list, only if it is still in-flight (a reaper may have returned it)
+var migrateListScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// migrateSetScript moves a scheduled member to the same score in its new set
+var migrateSetScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 1 then
+	redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// Router returns the partition of the current layout a raw task belongs to
+type Router func(raw []byte) types.PartitionID
+
+// Rewriter returns the partition of the current layout a raw dead letter
+// belongs to, and the entry updated for it
+type Rewriter func(raw []byte) (types.PartitionID, []byte)
+
+// Migrator moves the tasks of a partition of a retired layout to the
+// partitions of the current one, after a resize. The partition owner runs it,
+// alongside consuming the partition
+type Migrator struct {
+	conn     conn.IConn
+	workerID types.WorkerID
+}
+
+func NewMigrator(conn conn.IConn, workerID types.WorkerID) *Migrator {
+	return &Migrator{conn: conn, workerID: workerID}
+}
+
+// Migrate moves up to batch tasks of every pending list, delayed set and
+// retry set of the partition, keeping their priority and due time
+func (m *Migrator) Migrate(ctx context.Context, from types.PartitionID, route Router, batch int) (int, error) {
+	moved := 0
+
+	for _, level := range Priorities {
+		n, err := m.moveList(ctx, PriorityKey(TaskKey(from), level), batch, func(raw []byte) (string, []byte) {
+			return PriorityKey(TaskKey(route(raw)), level), raw
+		})
+		moved += n
+		if err != nil {
+			return moved, err
+		}
+
+		for _, set := range []func(types.PartitionID) string{DelayedKey, RetryKey} {
+			n, err := m.moveSet(ctx, PriorityKey(set(from), level), batch, func(raw []byte) string {
+				return PriorityKey(set(route(raw)), level)
+			})
+			moved += n
+			if err != nil {
+				return moved, err
+			}
+		}
+	}
+
+	return moved, nil
+}
+
+// MigrateDeadLetters moves up to batch entries of the partition dead letter list
+func (m *Migrator) MigrateDeadLetters(ctx context.Context, from types.PartitionID, rewrite Rewriter, batch int) (int, error) {
+	return m.moveList(ctx, DeadLetterKey(from), batch, func(raw []byte) (string, []byte) {
+		partitionID, entry := rewrite(raw)
+		return DeadLetterKey(partitionID), entry
+	})
+}
+
+// moveList takes members from the tail of src through our in-flight list, so a
+// crash never loses one, and pushes them to the head of their new list: the
+// oldest tasks of the old layout are consumed before the new ones
+func (m *Migrator) moveList(ctx context.Context, src string, batch int, target func(raw []byte) (string, []byte)) (int, error) {
+	rdb := m.conn.GetRedis()
+	inflight := ProcessingKey(m.workerID, src)
+
+	moved := 0
+	for moved < batch {
+		raw, err := rdb.LMove(ctx, src, inflight, "RIGHT", "LEFT").Result()
+		if errors.Is(err, redis.Nil) {
+			return moved, nil
+		}
+		if err != nil {
+			return moved, err
+		}
+
+		dst, value := target([]byte(raw))
+		if err := migrateListScript.Run(ctx, rdb, []string{inflight, dst}, raw, value).Err(); err != nil {
+			// left in-flight, the reaper returns it to src if we die
+			return moved, err
+		}
+		moved++
+	}
+
+	return moved, nil
+}
+
+func (m *Migrator) moveSet(ctx context.Context, src string, batch int, target func(raw []byte) string) (int, error) {
+	rdb := m.conn.GetRedis()
+
+	members, err := rdb.ZRangeWithScores(ctx, src, 0, int64(batch-1)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, z := range members {
+		raw, _ := z.Member.(string)
+		n, err := migrateSetScript.Run(ctx, rdb, []string{src, target([]byte(raw))}, raw, z.Score).Int()
+		if err != nil {
+			return moved, err
+		}
+		moved += n
+	}
+
+	return moved, nil
+}
+
+// Drained tells whether nothing is left on the partitions: no pending,
+// scheduled or dead lettered task and nothing in-flight from them
+func (m *Migrator) Drained(ctx context.Context, partitions []types.PartitionID) (bool, error) {
+	rdb := m.conn.GetRedis()
+	retired := map[types.PartitionID]bool{}
+
+	keys := make([]string, 0, 1000)
+	for _, partitionID := range partitions {
+		retired[partitionID] = true
+
+		keys = append(keys, DeadLetterKey(partitionID))
+		for _, level := range Priorities {
+			keys = append(keys,
+				PriorityKey(TaskKey(partitionID), level),
+				PriorityKey(DelayedKey(partitionID), level),
+				PriorityKey(RetryKey(partitionID), level),
+			)
+		}
+
+		if len(keys) < 990 {
+			continue
+		}
+		if n, err := rdb.Exists(ctx, keys...).Result(); err != nil || n > 0 {
+			return false, err
+		}
+		keys = keys[:0]
+	}
+
+	if len(keys) > 0 {
+		if n, err := rdb.Exists(ctx, keys...).Result(); err != nil || n > 0 {
+			return false, err
+		}
+	}
+
+	iter := rdb.Scan(ctx, 0, processingPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		_, source, ok := parseProcessingKey(iter.Val())
+		if !ok {
+			continue
+		}
+		if partitionID, ok := keyPartition(source); ok && retired[partitionID] {
+			return false, nil
+		}
+	}
+
+	return true, iter.Err()
+}
+
+// keyPartition reads the partition of a <kind>:N[:priority] key
+func keyPartition(key string) (types.PartitionID, bool) {
+	parts := strings.Split(key, ":")
+	if len(parts) < 2 {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return types.PartitionID(id), true
+}
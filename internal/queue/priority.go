@@ -0,0 +1,156 @@
+package queue
+
+import (
+	"dtq/internal/types"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+)
+
+// Priority of a task inside its partition. Each level has its own list:
+// tasks:N:high, tasks:N (default) and tasks:N:low
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityDefault
+	PriorityHigh
+)
+
+// Priorities from the highest to the lowest level
+var Priorities = []Priority{PriorityHigh, PriorityDefault, PriorityLow}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	}
+	return "default"
+}
+
+func ParsePriority(s string) (Priority, error) {
+	for _, p := range Priorities {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return PriorityDefault, fmt.Errorf("queue: unknown priority %q", s)
+}
+
+// PriorityKey suffixes a partition key (tasks:N, retry:N, delayed:N) with the
+// priority level. The default level keeps the bare key, so tasks pushed before
+// priorities existed are still consumed
+func PriorityKey(key string, p Priority) string {
+	if p == PriorityDefault {
+		return key
+	}
+	return key + ":" + p.String()
+}
+
+// PriorityFromKey reads the level back from a tasks:N[:priority] key
+func PriorityFromKey(key string) Priority {
+	parts := strings.Split(key, ":")
+	if len(parts) < 3 {
+		return PriorityDefault
+	}
+
+	p, err := ParsePriority(parts[2])
+	if err != nil {
+		return PriorityDefault
+	}
+	return p
+}
+
+type PriorityMode string
+
+const (
+	// PriorityStrict always drains higher levels first, low tasks may starve
+	PriorityStrict PriorityMode = "strict"
+	// PriorityWeighted picks the level checked first at random, proportionally
+	// to its weight, so lower levels keep a share of the throughput
+	PriorityWeighted PriorityMode = "weighted"
+)
+
+type PriorityPolicy struct {
+	Mode    PriorityMode
+	Weights map[Priority]int
+}
+
+func DefaultPriorityPolicy() PriorityPolicy {
+	return PriorityPolicy{
+		Mode: PriorityStrict,
+		Weights: map[Priority]int{
+			PriorityHigh:    6,
+			PriorityDefault: 3,
+			PriorityLow:     1,
+		},
+	}
+}
+
+// order returns the levels in the order they should be checked on this fetch
+func (p PriorityPolicy) order() []Priority {
+	if p.Mode != PriorityWeighted {
+		return Priorities
+	}
+
+	// weighted shuffle: draw the next level among the remaining ones by weight
+	remaining := append([]Priority(nil), Priorities...)
+	order := make([]Priority, 0, len(remaining))
+
+	for len(remaining) > 0 {
+		total := 0
+		for _, level := range remaining {
+			total += max(p.Weights[level], 0)
+		}
+
+		// levels without weight are only checked after the others
+		if total == 0 {
+			return append(order, remaining...)
+		}
+
+		pick := rand.IntN(total)
+		for i, level := range remaining {
+			pick -= max(p.Weights[level], 0)
+			if pick < 0 {
+				order = append(order, level)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return order
+}
+
+// keyOrder builds the list of source keys for a fetch: levels in policy order
+// and, inside each level, partitions rotated so the first ones are not favored
+type keyOrder struct {
+	policy PriorityPolicy
+	offset int
+
+	mu sync.Mutex
+}
+
+func (k *keyOrder) keys(partitions []types.PartitionID) []string {
+	if len(partitions) == 0 {
+		return nil
+	}
+
+	k.mu.Lock()
+	k.offset++
+	start := k.offset % len(partitions)
+	k.mu.Unlock()
+
+	keys := make([]string, 0, len(partitions)*len(Priorities))
+	for _, level := range k.policy.order() {
+		for i := range partitions {
+			partitionID := partitions[(start+i)%len(partitions)]
+			keys = append(keys, PriorityKey(TaskKey(partitionID), level))
+		}
+	}
+
+	return keys
+}
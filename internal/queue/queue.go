@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"context"
+	"dtq/internal/types"
+	"fmt"
+	"time"
+)
+
+// Delivery is a task popped from one of the partition lists
+type Delivery struct {
+	Partition types.PartitionID
+	Priority  Priority
+	Source    string
+	Raw       string
+	// Token is the fencing token of the partition claim the delivery was
+	// fetched under, zero when the partition is not fenced
+	Token int64
+}
+
+type IQueue interface {
+	// Fetch blocks until a task is available on one of the partitions or ctx is done
+	Fetch(ctx context.Context, partitions []types.PartitionID) (*Delivery, error)
+	// Ack marks the delivery as done, it will never be redelivered.
+	//
+	// Ack, Requeue, Retry and DeadLetter return ErrStaleOwner, and hand the
+	// delivery back to its list, when d.Token is older than the partition fence
+	Ack(ctx context.Context, d *Delivery) error
+	// Requeue acks the delivery and puts raw (the delivery itself or an updated
+	// task) back to the head of its source list
+	Requeue(ctx context.Context, d *Delivery, raw []byte) error
+	// RecoverWorker returns to their source lists the in-flight tasks a worker
+	// fetched from one partition
+	RecoverWorker(ctx context.Context, workerID types.WorkerID, partition types.PartitionID) (int, error)
+	// Retry acks the delivery and schedules raw (the updated task) on the partition retry set
+	Retry(ctx context.Context, d *Delivery, raw []byte, due time.Time) error
+	// Forward acks the delivery and pushes it to the head of the same priority
+	// list of another partition, for a task that belongs to a task type route
+	Forward(ctx context.Context, d *Delivery, target types.PartitionID) error
+	// DeadLetter acks the delivery and pushes entry to the head of the partition dead letter list
+	DeadLetter(ctx context.Context, d *Delivery, entry []byte) error
+	// Recover returns in-flight tasks of dead workers to their source lists
+	Recover(ctx context.Context, alive map[types.WorkerID]bool) (int, error)
+}
+
+func newDelivery(source, raw string) *Delivery {
+	return &Delivery{
+		Partition: partitionFromKey(source),
+		Priority:  PriorityFromKey(source),
+		Source:    source,
+		Raw:       raw,
+	}
+}
+
+// partitionFromKey reads the partition back from a tasks:N[:priority] key
+func partitionFromKey(key string) types.PartitionID {
+	var partition types.PartitionID
+	_, _ = fmt.Sscanf(key, "tasks:%d", &partition)
+	return partition
+}
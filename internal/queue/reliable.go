@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/types"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fetchScript moves the head of the first non empty source list into the
+// worker processing list for that source. Lua runs atomically, so the task is
+// either still pending or in-flight, never in between
+var fetchScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	local task = redis.call('LMOVE', key, ARGV[1] .. key, 'LEFT', 'LEFT')
+	if task then
+		return {key, task}
+	end
+end
+return false
+`)
+
+// fetchTimeout bounds the fetch script call. The call does not use the
+// caller ctx: if the reply was dropped after the script ran, the task would sit
+// in our processing list with nobody handling it
+const fetchTimeout = 5 * time.Second
+
+// ReliableQueue gives at-least-once delivery: fetched tasks are kept in a per worker
+// processing list until acked, and a reaper returns them to their partition
+// when the worker lease is gone
+type ReliableQueue struct {
+	conn         conn.IConn
+	workerID     types.WorkerID
+	pollInterval time.Duration
+	order        *keyOrder
+}
+
+func NewReliableQueue(conn conn.IConn, workerID types.WorkerID, pollInterval time.Duration, priorities PriorityPolicy) IQueue {
+	return &ReliableQueue{
+		conn:         conn,
+		workerID:     workerID,
+		pollInterval: pollInterval,
+		order:        &keyOrder{policy: priorities},
+	}
+}
+
+func (q *ReliableQueue) Fetch(ctx context.Context, partitions []types.PartitionID) (*Delivery, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// the script takes the first non empty key, so the key order is the priority order
+		d, err := q.tryFetch(q.order.keys(partitions))
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			return d, nil
+		}
+
+		// nothing pending on any partition, wait before polling again
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(q.pollInterval):
+		}
+	}
+}
+
+func (q *ReliableQueue) tryFetch(keys []string) (*Delivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	prefix := ProcessingKey(q.workerID, "")
+
+	res, err := fetchScript.Run(ctx, q.conn.GetRedis(), keys, prefix).StringSlice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return newDelivery(res[0], res[1]), nil
+}
+
+func (q *ReliableQueue) Ack(ctx context.Context, d *Delivery) error {
+	return settle(ctx, q.conn.GetRedis(), d, q.processing(d), settleAck, "", nil, 0)
+}
+
+func (q *ReliableQueue) Requeue(ctx context.Context, d *Delivery, raw []byte) error {
+	return settle(ctx, q.conn.GetRedis(), d, q.processing(d), settleRequeue, d.Source, raw, 0)
+}
+
+func (q *ReliableQueue) Forward(ctx context.Context, d *Delivery, target types.PartitionID) error {
+	return settle(ctx, q.conn.GetRedis(), d, q.processing(d), settleRequeue, PriorityKey(TaskKey(target), d.Priority), []byte(d.Raw), 0)
+}
+
+// Retry schedules the new attempt and removes the delivery from the processing
+// list in one script, the task is never in both places or in none
+func (q *ReliableQueue) Retry(ctx context.Context, d *Delivery, raw []byte, due time.Time) error {
+	return settle(ctx, q.conn.GetRedis(), d, q.processing(d), settleRetry, PriorityKey(RetryKey(d.Partition), d.Priority), raw, due.UnixMilli())
+}
+
+func (q *ReliableQueue) DeadLetter(ctx context.Context, d *Delivery, entry []byte) error {
+	return settle(ctx, q.conn.GetRedis(), d, q.processing(d), settleDead, DeadLetterKey(d.Partition), entry, 0)
+}
+
+func (q *ReliableQueue) processing(d *Delivery) string {
+	return ProcessingKey(q.workerID, d.Source)
+}
+
+// Recover scans every processing list and moves the tasks of workers not in alive
+// back to the head of their source list. Each LMOVE is atomic, so concurrent
+// reapers never return the same task twice
+func (q *ReliableQueue) Recover(ctx context.Context, alive map[types.WorkerID]bool) (int, error) {
+	recovered := 0
+
+	iter := q.conn.GetRedis().Scan(ctx, 0, processingPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+
+		workerID, source, ok := parseProcessingKey(key)
+		if !ok || alive[workerID] {
+			continue
+		}
+
+		n, err := q.moveBack(ctx, key, source)
+		recovered += n
+		if err != nil {
+			return recovered, err
+		}
+	}
+
+	return recovered, iter.Err()
+}
+
+func (q *ReliableQueue) RecoverWorker(ctx context.Context, workerID types.WorkerID, partition types.PartitionID) (int, error) {
+	recovered := 0
+
+	for _, level := range Priorities {
+		source := PriorityKey(TaskKey(partition), level)
+
+		n, err := q.moveBack(ctx, ProcessingKey(workerID, source), source)
+		recovered += n
+		if err != nil {
+			return recovered, err
+		}
+	}
+
+	return recovered, nil
+}
+
+func (q *ReliableQueue) moveBack(ctx context.Context, key, source string) (int, error) {
+	moved := 0
+
+	for {
+		// newest in-flight first, so the oldest ends up at the head of the source
+		err := q.conn.GetRedis().LMove(ctx, key, source, "LEFT", "LEFT").Err()
+		if errors.Is(err, redis.Nil) {
+			return moved, nil
+		}
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"context"
+	"dtq/internal/conn"
+	"dtq/internal/types"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// promoteScript takes KEYS as (sorted set, list) pairs and moves up to ARGV[2]
+// members scored <= ARGV[1] of each set to the tail of its list, atomically.
+// It returns the total moved and the largest number moved for a single pair
+var promoteScript = redis.NewScript(`
+local total, most = 0, 0
+for i = 1, #KEYS, 2 do
+	local due = redis.call('ZRANGEBYSCORE', KEYS[i], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+	for _, member in ipairs(due) do
+		redis.call('RPUSH', KEYS[i + 1], member)
+		redis.call('ZREM', KEYS[i], member)
+	end
+	total = total + #due
+	most = math.max(most, #due)
+end
+return {total, most}
+`)
+
+// promoteBatch bounds the work of a single script call so redis is not blocked
+const promoteBatch = 500
+
+// Scheduler moves tasks that became due from the partition sorted sets
+// (delayed:N and retry:N) into tasks:N. Only the partition owner promotes, so no extra process is needed
+type Scheduler struct {
+	conn conn.IConn
+}
+
+type IScheduler interface {
+	Promote(ctx context.Context, partitions []types.PartitionID, now time.Time) (int, error)
+}
+
+func NewScheduler(conn conn.IConn) IScheduler {
+	return &Scheduler{conn: conn}
+}
+
+func (s *Scheduler) Promote(ctx context.Context, partitions []types.PartitionID, now time.Time) (int, error) {
+	promoted := 0
+
+	for _, partitionID := range partitions {
+		n, err := s.promote(ctx, promoteKeys(partitionID), now)
+		promoted += n
+		if err != nil {
+			return promoted, err
+		}
+	}
+
+	return promoted, nil
+}
+
+// promoteKeys pairs every delayed and retry set of the partition with the task
+// list of the same priority
+func promoteKeys(partitionID types.PartitionID) []string {
+	keys := make([]string, 0, 4*len(Priorities))
+	for _, level := range Priorities {
+		list := PriorityKey(TaskKey(partitionID), level)
+		keys = append(keys,
+			PriorityKey(DelayedKey(partitionID), level), list,
+			PriorityKey(RetryKey(partitionID), level), list,
+		)
+	}
+	return keys
+}
+
+func (s *Scheduler) promote(ctx context.Context, keys []string, now time.Time) (int, error) {
+	promoted := 0
+
+	for {
+		res, err := promoteScript.Run(ctx, s.conn.GetRedis(), keys, now.UnixMilli(), promoteBatch).Int64Slice()
+		if err != nil {
+			return promoted, err
+		}
+
+		promoted += int(res[0])
+		// no set had more than a batch due, everything was moved
+		if res[1] < promoteBatch {
+			return promoted, nil
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"dtq/internal/types"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Prefix is the etcd prefix of the worker registrations, held under each worker lease
+const Prefix = "worker_id:"
+
+// Key is the registration key of a worker
+func Key(workerID types.WorkerID) string {
+	return fmt.Sprintf("%s%s", Prefix, workerID)
+}
+
+// Version is the build of the worker, published in its record. Set it with
+// -ldflags "-X dtq/internal/registry.Version=v1.2.3"
+var Version = "dev"
+
+// Record is the value of a worker registration. Every worker builds its ring
+// from these records, so they must be all it takes to compute the assignment.
+// Tooling and the metrics target discovery read them too
+type Record struct {
+	Version  string `json:"version,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	// Zone is the availability zone (or rack) the worker runs in, empty when unknown
+	Zone string `json:"zone,omitempty"`
+	// Weight is the worker capacity relative to the others, a weight 4 worker
+	// gets about 4 times the partitions of a weight 1 worker
+	Weight int `json:"weight"`
+	// TaskTypes are the task types the worker has a handler for
+	TaskTypes []string `json:"task_types,omitempty"`
+	// MetricsEndpoint is the host:port prometheus scrapes
+	MetricsEndpoint string    `json:"metrics_endpoint,omitempty"`
+	StartedAt       time.Time `json:"started_at,omitzero"`
+}
+
+// Parse reads a registration value. Workers that registered the plain "live"
+// value (or anything unreadable) count with weight 1 and nothing else known
+func Parse(value []byte) Record {
+	var r Record
+	if err := json.Unmarshal(value, &r); err != nil {
+		return Record{Weight: 1}
+	}
+	r.Weight = ClampWeight(r.Weight)
+	return r
+}
+
+// WorkerID reads the worker id back from a registration key
+func WorkerID(key []byte) (types.WorkerID, bool) {
+	id, ok := strings.CutPrefix(string(key), Prefix)
+	if !ok || id == "" {
+		return "", false
+	}
+	return types.WorkerID(id), true
+}
+
+func (r Record) Marshal() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ClampWeight keeps a weight within [1, types.MAX_WEIGHT]
+func ClampWeight(weight int) int {
+	return min(max(weight, 1), types.MAX_WEIGHT)
+}
@@ -0,0 +1,70 @@
+package retry
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// maxBackoff is where the backoffs saturate, about 146 years. It stays below
+// math.MaxInt64 so a jittered delay can add its +1 without overflowing
+const maxBackoff = time.Duration(1 << 62)
+
+// Backoff returns how long to wait before the given retry, attempt starts at 1
+type Backoff interface {
+	Delay(attempt int) time.Duration
+}
+
+// ExponentialBackoff waits Base * Factor^(attempt-1). Factor defaults to 2 when
+// unset (zero or negative), a Factor of 1 always waits Base
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Factor float64
+}
+
+func (b ExponentialBackoff) Delay(attempt int) time.Duration {
+	factor := b.Factor
+	if factor <= 0 {
+		factor = 2
+	}
+
+	delay := float64(b.Base) * math.Pow(factor, float64(max(attempt-1, 0)))
+	if delay >= float64(maxBackoff) {
+		return maxBackoff
+	}
+	return time.Duration(delay)
+}
+
+// LinearBackoff waits Base + Step*(attempt-1)
+type LinearBackoff struct {
+	Base time.Duration
+	Step time.Duration
+}
+
+func (b LinearBackoff) Delay(attempt int) time.Duration {
+	steps := time.Duration(max(attempt-1, 0))
+	if b.Step > 0 && steps > (maxBackoff-b.Base)/b.Step {
+		return maxBackoff
+	}
+	return b.Base + b.Step*steps
+}
+
+// JitteredBackoff picks a random delay in [0, inner delay] ("full jitter"),
+// so tasks that failed together do not all come back at once
+type JitteredBackoff struct {
+	Backoff Backoff
+	// Max caps the inner delay before the jitter is applied, zero means no cap.
+	// Policy.Next sets it to the policy MaxDelay
+	Max time.Duration
+}
+
+func (b JitteredBackoff) Delay(attempt int) time.Duration {
+	delay := min(b.Backoff.Delay(attempt), maxBackoff)
+	if b.Max > 0 {
+		delay = min(delay, b.Max)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(delay) + 1))
+}
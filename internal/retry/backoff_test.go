@@ -0,0 +1,146 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff ExponentialBackoff
+		attempt int
+		want    time.Duration
+	}{
+		{"first attempt waits base", ExponentialBackoff{Base: time.Second}, 1, time.Second},
+		{"attempt 0 waits base", ExponentialBackoff{Base: time.Second}, 0, time.Second},
+		{"factor defaults to 2", ExponentialBackoff{Base: time.Second}, 4, 8 * time.Second},
+		{"negative factor defaults to 2", ExponentialBackoff{Base: time.Second, Factor: -3}, 3, 4 * time.Second},
+		{"factor 1 is constant", ExponentialBackoff{Base: time.Second, Factor: 1}, 10, time.Second},
+		{"fractional factor", ExponentialBackoff{Base: time.Second, Factor: 1.5}, 3, 2250 * time.Millisecond},
+		{"factor below 1 shrinks", ExponentialBackoff{Base: time.Second, Factor: 0.5}, 2, 500 * time.Millisecond},
+		{"factor 3", ExponentialBackoff{Base: 100 * time.Millisecond, Factor: 3}, 3, 900 * time.Millisecond},
+		{"saturates", ExponentialBackoff{Base: time.Second}, 1000, maxBackoff},
+		{"saturates just past the limit", ExponentialBackoff{Base: time.Second}, 64, maxBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.Delay(tt.attempt); got != tt.want {
+				t.Fatalf("Delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinearBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff LinearBackoff
+		attempt int
+		want    time.Duration
+	}{
+		{"first attempt waits base", LinearBackoff{Base: time.Second, Step: time.Minute}, 1, time.Second},
+		{"steps", LinearBackoff{Base: time.Second, Step: time.Minute}, 3, time.Second + 2*time.Minute},
+		{"no step is constant", LinearBackoff{Base: time.Second}, 50, time.Second},
+		{"saturates", LinearBackoff{Base: time.Second, Step: 1000 * time.Hour}, 1 << 30, maxBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.Delay(tt.attempt); got != tt.want {
+				t.Fatalf("Delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitteredBackoffBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff JitteredBackoff
+		attempt int
+		max     time.Duration
+	}{
+		{"within the inner delay", JitteredBackoff{Backoff: ExponentialBackoff{Base: time.Second}}, 3, 4 * time.Second},
+		{"capped by Max", JitteredBackoff{Backoff: ExponentialBackoff{Base: time.Second}, Max: 3 * time.Second}, 10, 3 * time.Second},
+		{"saturated inner delay", JitteredBackoff{Backoff: ExponentialBackoff{Base: time.Second}}, 1000, maxBackoff},
+		{"zero inner delay", JitteredBackoff{Backoff: LinearBackoff{}}, 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spread := false
+			for range 500 {
+				got := tt.backoff.Delay(tt.attempt)
+				if got < 0 || got > tt.max {
+					t.Fatalf("Delay(%d) = %s, want within [0, %s]", tt.attempt, got, tt.max)
+				}
+				if got != tt.max {
+					spread = true
+				}
+			}
+			if tt.max > 0 && !spread {
+				t.Fatalf("Delay(%d) is always %s, no jitter applied", tt.attempt, tt.max)
+			}
+		})
+	}
+}
+
+func TestPolicyNext(t *testing.T) {
+	p := Policy{
+		MaxAttempts: 4,
+		Backoff:     ExponentialBackoff{Base: time.Second},
+		MaxDelay:    3 * time.Second,
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	for failed, delay := range want {
+		got, ok := p.Next(failed + 1)
+		if !ok || got != delay {
+			t.Fatalf("Next(%d) = %s, %v, want %s, true", failed+1, got, ok, delay)
+		}
+	}
+
+	if _, ok := p.Next(4); ok {
+		t.Fatal("Next(4) retried a task whose attempts are exhausted")
+	}
+
+	if delay, ok := NoRetry().Next(1); ok || delay != 0 {
+		t.Fatalf("NoRetry().Next(1) = %s, %v, want no retry", delay, ok)
+	}
+	if delay, ok := (Policy{MaxAttempts: 2}).Next(1); !ok || delay != 0 {
+		t.Fatalf("Next without backoff = %s, %v, want an immediate retry", delay, ok)
+	}
+}
+
+func TestPolicyNextClampsBeforeJitter(t *testing.T) {
+	p := DefaultPolicy()
+	p.MaxAttempts = 1000
+
+	belowMax := false
+	for failed := 1; failed < p.MaxAttempts; failed++ {
+		delay, ok := p.Next(failed)
+		if !ok {
+			t.Fatalf("Next(%d) gave up before MaxAttempts", failed)
+		}
+		if delay < 0 || delay > p.MaxDelay {
+			t.Fatalf("Next(%d) = %s, want within [0, %s]", failed, delay, p.MaxDelay)
+		}
+		// late retries are jittered over [0, MaxDelay], not pinned to MaxDelay
+		if failed > 100 && delay < p.MaxDelay {
+			belowMax = true
+		}
+	}
+	if !belowMax {
+		t.Fatal("every late retry waited MaxDelay exactly, the jitter was applied before the clamp")
+	}
+
+	// without MaxDelay the saturated backoff must not overflow the jitter
+	p.MaxDelay = 0
+	for failed := 1; failed < p.MaxAttempts; failed++ {
+		if delay, _ := p.Next(failed); delay < 0 || delay > maxBackoff {
+			t.Fatalf("Next(%d) = %s without MaxDelay", failed, delay)
+		}
+	}
+}
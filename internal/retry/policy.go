@@ -0,0 +1,51 @@
+package retry
+
+import "time"
+
+// Policy decides if and when a failed task runs again
+type Policy struct {
+	// MaxAttempts counts every run including the first one, 1 means never retry
+	MaxAttempts int
+	Backoff     Backoff
+	// MaxDelay caps the backoff, zero means no cap
+	MaxDelay time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: 5,
+		Backoff:     JitteredBackoff{Backoff: ExponentialBackoff{Base: time.Second}},
+		MaxDelay:    5 * time.Minute,
+	}
+}
+
+// NoRetry fails a task on its first error
+func NoRetry() Policy {
+	return Policy{MaxAttempts: 1}
+}
+
+// Next returns the delay before the next run of a task that has already failed
+// `failed` times, false when the attempts are exhausted
+func (p Policy) Next(failed int) (time.Duration, bool) {
+	if failed >= p.MaxAttempts {
+		return 0, false
+	}
+
+	if p.Backoff == nil {
+		return 0, true
+	}
+
+	backoff := p.Backoff
+	// capped before the jitter, or every late retry would wait MaxDelay exactly
+	if jittered, ok := backoff.(JitteredBackoff); ok && jittered.Max == 0 {
+		jittered.Max = p.MaxDelay
+		backoff = jittered
+	}
+
+	delay := backoff.Delay(failed)
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay, true
+}
@@ -0,0 +1,60 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"math"
+)
+
+// WithBoundedLoads turns on consistent hashing with bounded loads: no worker
+// gets more than ceil((1+epsilon) * its fair share) partitions, the fair share
+// following the worker weight. A partition whose successor is full goes to the
+// next worker clockwise that still has room.
+//
+// Partitions are placed in id order, so every worker computes the same
+// assignment from the same membership and epsilon. A smaller epsilon evens the
+// load out but moves more partitions on membership changes, 0.25 is a sane start
+func WithBoundedLoads(epsilon float64) RingOption {
+	return func(h *HashRing) {
+		h.epsilon = max(epsilon, 0)
+	}
+}
+
+// assignBounded recomputes the bounded assignment, the lock must be held
+func (h *HashRing) assignBounded() {
+	if h.epsilon <= 0 || len(h.VNodes) == 0 {
+		h.bounded = nil
+		return
+	}
+
+	// vnodes follow the weights, so they give each worker share
+	totalVNodes := 0
+	for _, vnodes := range h.members {
+		totalVNodes += vnodes
+	}
+
+	capacity := make(map[types.WorkerID]int, len(h.members))
+	for workerID, vnodes := range h.members {
+		share := float64(h.totalPartitions) * float64(vnodes) / float64(totalVNodes)
+		capacity[workerID] = int(math.Ceil((1 + h.epsilon) * share))
+	}
+
+	// the capacities add up to at least totalPartitions, the walk always ends
+	// on a worker with room
+	loads := make(map[types.WorkerID]int, len(h.members))
+	assignment := make([]types.WorkerID, h.totalPartitions)
+
+	for partitionID := range h.totalPartitions {
+		idx := h.successor(partitionID)
+
+		for i := range len(h.VNodes) {
+			workerID := h.Nodes[h.VNodes[(idx+i)%len(h.VNodes)]]
+			if loads[workerID] < capacity[workerID] {
+				assignment[partitionID] = workerID
+				loads[workerID]++
+				break
+			}
+		}
+	}
+
+	h.bounded = assignment
+}
@@ -0,0 +1,123 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"math"
+	"testing"
+)
+
+// checkBounded fails when a worker holds more than ceil((1+epsilon) * P * w/W)
+// partitions or a partition has no owner
+func checkBounded(t *testing.T, r IHashRing, weights map[types.WorkerID]int, epsilon float64) {
+	t.Helper()
+
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	held := 0
+	for workerID, weight := range weights {
+		limit := int(math.Ceil((1 + epsilon) * float64(testPartitions) * float64(weight) / float64(total)))
+
+		load := len(r.FetchPartitionsForNode(workerID))
+		if load > limit {
+			t.Fatalf("%s (weight %d) holds %d partitions, the cap is %d", workerID, weight, load, limit)
+		}
+		held += load
+	}
+
+	if held != testPartitions {
+		t.Fatalf("workers hold %d partitions, want %d", held, testPartitions)
+	}
+	for partitionID, owner := range owners(r) {
+		if _, ok := weights[owner]; !ok {
+			t.Fatalf("partition %d went to %q, not a member", partitionID, owner)
+		}
+	}
+}
+
+func TestBoundedLoadsCap(t *testing.T) {
+	ids := workers(11)
+
+	equal := map[types.WorkerID]int{}
+	for _, workerID := range ids[:10] {
+		equal[workerID] = 1
+	}
+	tenToOne := map[types.WorkerID]int{ids[0]: 10, ids[1]: 1}
+	mixed := map[types.WorkerID]int{ids[0]: 1, ids[1]: 2, ids[2]: 3, ids[3]: 5, ids[4]: 8}
+	single := map[types.WorkerID]int{ids[0]: 3}
+
+	tests := []struct {
+		name    string
+		weights map[types.WorkerID]int
+		epsilon float64
+	}{
+		{"equal weights", equal, 0.25},
+		{"equal weights tight", equal, 0.01},
+		{"equal weights loose", equal, 2},
+		{"10:1 weights", tenToOne, 0.25},
+		{"10:1 weights tight", tenToOne, 0.01},
+		{"mixed weights", mixed, 0.1},
+		{"single worker", single, 0.25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewConsistentHashRing(testPartitions, WithBoundedLoads(tt.epsilon))
+			for workerID, weight := range tt.weights {
+				r.AddNodes(workerID, weight)
+			}
+
+			checkBounded(t, r, tt.weights, tt.epsilon)
+		})
+	}
+}
+
+func TestBoundedLoadsRemoveAndAddAgain(t *testing.T) {
+	const epsilon = 0.1
+
+	ids := workers(6)
+	weights := map[types.WorkerID]int{}
+	r := NewConsistentHashRing(testPartitions, WithBoundedLoads(epsilon))
+	for i, workerID := range ids {
+		weights[workerID] = i%3 + 1
+		r.AddNodes(workerID, weights[workerID])
+	}
+	checkBounded(t, r, weights, epsilon)
+	before := owners(r)
+
+	// the partitions of the leaving worker spread without breaking the others' cap
+	r.RemoveNode(ids[2])
+	delete(weights, ids[2])
+	checkBounded(t, r, weights, epsilon)
+
+	// a heavier weight raises the cap of the worker
+	weights[ids[0]] = 10
+	r.AddNodes(ids[0], 10)
+	checkBounded(t, r, weights, epsilon)
+
+	// back to the first membership, the assignment only depends on it
+	weights[ids[0]] = 1
+	r.AddNodes(ids[0], 1)
+	weights[ids[2]] = 3
+	r.AddNodes(ids[2], 3)
+	checkBounded(t, r, weights, epsilon)
+
+	for partitionID, owner := range owners(r) {
+		if owner != before[partitionID] {
+			t.Fatalf("partition %d is on %s, it was on %s with the same membership", partitionID, owner, before[partitionID])
+		}
+	}
+}
+
+func TestBoundedLoadsOutOfRange(t *testing.T) {
+	r := NewConsistentHashRing(testPartitions, WithBoundedLoads(0.25))
+	r.AddNodes("worker-000", 1)
+
+	for _, partitionID := range []types.PartitionID{testPartitions, testPartitions + 4, math.MaxUint32} {
+		if owner := r.GetNodeForPartition(partitionID); owner != "" {
+			t.Fatalf("partition %d is outside the ring but went to %s", partitionID, owner)
+		}
+	}
+}
@@ -17,30 +17,50 @@ type HashRing struct {
 	Nodes           map[VNode]types.WorkerID
 	VNodes          []VNode
 	totalPartitions int
+	// members maps each worker to its vnode count
+	members map[types.WorkerID]int
+	// epsilon > 0 caps each worker load, see WithBoundedLoads. bounded is the
+	// resulting assignment, recomputed on every membership change
+	epsilon float64
+	bounded []types.WorkerID
 
 	mu sync.RWMutex
 }
 
+type RingOption func(h *HashRing)
+
 type IHashRing interface {
-	AddNodes(workerID types.WorkerID)
-	GetNodeForPartition(partitionID uint8) types.WorkerID
-	FetchPartitionsForNode(workerID types.WorkerID) []uint8
-	GetNodePartitions(workerID types.WorkerID) []uint8
+	AddNodes(workerID types.WorkerID, weight int)
+	GetNodeForPartition(partitionID types.PartitionID) types.WorkerID
+	FetchPartitionsForNode(workerID types.WorkerID) []types.PartitionID
+	GetNodePartitions(workerID types.WorkerID) []types.PartitionID
 	RemoveNode(workerID types.WorkerID)
 }
 
-func NewConsistentHashRing(partitions int) IHashRing {
-	return &HashRing{
+func NewConsistentHashRing(partitions int, opts ...RingOption) IHashRing {
+	h := &HashRing{
 		Nodes:           map[VNode]types.WorkerID{},
 		VNodes:          make([]VNode, 0),
 		totalPartitions: partitions,
+		members:         map[types.WorkerID]int{},
+	}
+
+	for _, opt := range opts {
+		opt(h)
 	}
+
+	return h
 }
 
 func hashFunc(key string) uint32 {
 	return murmur3.Sum32([]byte(key))
 }
 
+// vnodeCount is how many vnodes a worker of this weight places on the ring
+func vnodeCount(weight int) int {
+	return types.NUM_VNODES * min(max(weight, 1), types.MAX_WEIGHT)
+}
+
 func newVNodeKey(workerID types.WorkerID, i int) string {
 	return fmt.Sprintf("%s-node-%d", workerID, i)
 }
@@ -50,12 +70,29 @@ func newVNodeKey(workerID types.WorkerID, i int) string {
 // Consistent Hashing NÃO garante divisão perfeita, garante:
 //  1. divisão razoavelmente uniforme (10%-20% variação)
 //  2. movimento mínimo quando workers mudam
-func (h *HashRing) AddNodes(workerID types.WorkerID) {
+//
+// weight scales the vnodes of the worker (NUM_VNODES per unit), so its share of
+// partitions follows its capacity. vnode keys only depend on the worker id and
+// weight, every worker computes the same ring from the same registrations.
+//
+// adding a worker already in the ring with the same weight is a no-op, so
+// replaying membership is safe. A new weight replaces the old vnodes
+func (h *HashRing) AddNodes(workerID types.WorkerID, weight int) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	for i := range types.NUM_VNODES {
-		vnodeKey := newVNodeKey(workerID, int(i))
+	vnodes := vnodeCount(weight)
+
+	if current, ok := h.members[workerID]; ok {
+		if current == vnodes {
+			return
+		}
+		h.removeNode(workerID)
+	}
+	h.members[workerID] = vnodes
+
+	for i := range vnodes {
+		vnodeKey := newVNodeKey(workerID, i)
 		hash := VNode(hashFunc(vnodeKey))
 
 		h.Nodes[hash] = types.WorkerID(workerID)
@@ -63,9 +100,10 @@ func (h *HashRing) AddNodes(workerID types.WorkerID) {
 	}
 
 	slices.Sort(h.VNodes)
+	h.assignBounded()
 }
 
-func (h *HashRing) GetNodeForPartition(partitionID uint8) types.WorkerID {
+func (h *HashRing) GetNodeForPartition(partitionID types.PartitionID) types.WorkerID {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
@@ -73,56 +111,61 @@ func (h *HashRing) GetNodeForPartition(partitionID uint8) types.WorkerID {
 		return ""
 	}
 
-	partitionKey := fmt.Sprintf("partition:%d", partitionID)
-	partitionHash := VNode(hashFunc(partitionKey))
-
-	// search first hash >= partitionHash
-	idx := sort.Search(len(h.VNodes), func(i int) bool {
-		return h.VNodes[i] >= partitionHash
-	})
-
-	// wraparound circular: não achou nada maior, volta ao inicio
-	if idx >= len(h.VNodes) {
-		idx = 0
-	}
-
-	// worker id do vnode encontrado
-	vnodeHash := h.VNodes[idx]
-	return h.Nodes[vnodeHash]
+	return h.owner(int(partitionID))
 }
 
-func (h *HashRing) FetchPartitionsForNode(workerID types.WorkerID) []uint8 {
+func (h *HashRing) FetchPartitionsForNode(workerID types.WorkerID) []types.PartitionID {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if len(h.VNodes) == 0 {
-		return []uint8{}
+		return []types.PartitionID{}
 	}
 
-	partitions := make([]uint8, 0)
+	partitions := make([]types.PartitionID, 0)
 
 	for i := 0; i < h.totalPartitions; i++ {
-		partitionKey := fmt.Sprintf("partition:%d", i)
-		partitionHash := VNode(hashFunc(partitionKey))
+		if h.owner(i) == workerID {
+			partitions = append(partitions, types.PartitionID(i))
+		}
+	}
 
-		idx := sort.Search(len(h.VNodes), func(i int) bool {
-			return h.VNodes[i] >= partitionHash
-		})
+	return partitions
+}
 
-		if idx >= len(h.VNodes) {
-			idx = 0
+// owner is the worker of a partition, the ring must not be empty
+func (h *HashRing) owner(partitionID int) types.WorkerID {
+	if h.bounded != nil {
+		// only the partitions of the ring have a bounded owner, like tableRing
+		if partitionID < 0 || partitionID >= len(h.bounded) {
+			return ""
 		}
+		return h.bounded[partitionID]
+	}
 
-		owner := h.Nodes[h.VNodes[idx]]
-		if owner == workerID {
-			partitions = append(partitions, uint8(i))
-		}
+	// worker id do vnode encontrado
+	return h.Nodes[h.VNodes[h.successor(partitionID)]]
+}
+
+// successor is the index of the first vnode at or after the partition hash
+func (h *HashRing) successor(partitionID int) int {
+	partitionKey := fmt.Sprintf("partition:%d", partitionID)
+	partitionHash := VNode(hashFunc(partitionKey))
+
+	// search first hash >= partitionHash
+	idx := sort.Search(len(h.VNodes), func(i int) bool {
+		return h.VNodes[i] >= partitionHash
+	})
+
+	// wraparound circular: não achou nada maior, volta ao inicio
+	if idx >= len(h.VNodes) {
+		idx = 0
 	}
 
-	return partitions
+	return idx
 }
 
-func (h *HashRing) GetNodePartitions(workerID types.WorkerID) []uint8 {
+func (h *HashRing) GetNodePartitions(workerID types.WorkerID) []types.PartitionID {
 	return h.FetchPartitionsForNode(workerID)
 }
 
@@ -130,7 +173,17 @@ func (h *HashRing) RemoveNode(workerID types.WorkerID) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	for i := range int(types.NUM_VNODES) {
+	h.removeNode(workerID)
+}
+
+func (h *HashRing) removeNode(workerID types.WorkerID) {
+	vnodes, ok := h.members[workerID]
+	if !ok {
+		return
+	}
+	delete(h.members, workerID)
+
+	for i := range vnodes {
 		vnodeKey := newVNodeKey(workerID, i)
 		hash := hashFunc(vnodeKey)
 		delete(h.Nodes, VNode(hash))
@@ -143,4 +196,5 @@ func (h *HashRing) RemoveNode(workerID types.WorkerID) {
 	}
 
 	slices.Sort(h.VNodes)
+	h.assignBounded()
 }
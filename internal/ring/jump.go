@@ -0,0 +1,42 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"fmt"
+
+	"github.com/twmb/murmur3"
+)
+
+// assignJump maps partitions with jump consistent hash (Lamping & Veach). The
+// buckets are the workers sorted by id, each repeated by its weight.
+//
+// Jump hash only moves the minimum when buckets are added or removed at the
+// end, a worker leaving from the middle of the order shifts the others
+func assignJump(members []member, partitions int) []types.WorkerID {
+	buckets := make([]types.WorkerID, 0, len(members))
+	for _, m := range members {
+		for range m.weight {
+			buckets = append(buckets, m.workerID)
+		}
+	}
+
+	table := make([]types.WorkerID, partitions)
+	for partitionID := range partitions {
+		key := murmur3.Sum64([]byte(fmt.Sprintf("partition:%d", partitionID)))
+		table[partitionID] = buckets[jumpHash(key, len(buckets))]
+	}
+
+	return table
+}
+
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+
+	return int(b)
+}
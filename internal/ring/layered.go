@@ -0,0 +1,204 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"slices"
+	"sync"
+)
+
+// Range is a block of partition ids, [First, First+Count)
+type Range struct {
+	First types.PartitionID
+	Count int
+	// TaskType restricts the range to the members supporting it, empty means
+	// every member
+	TaskType string
+}
+
+// Member is a worker of the ring with what it advertised at registration
+type Member struct {
+	Weight    int
+	TaskTypes []string
+	// Zone is only used by zone aware rings (see NewZoned)
+	Zone string
+}
+
+// serves tells whether the member takes part in the ring of the range
+func (r Range) serves(m Member) bool {
+	return r.TaskType == "" || slices.Contains(m.TaskTypes, r.TaskType)
+}
+
+func (r Range) contains(partitionID types.PartitionID) bool {
+	return partitionID >= r.First && int(partitionID-r.First) < r.Count
+}
+
+// Factory builds the ring of one range, over the partitions [0, partitions)
+type Factory func(partitions int) IHashRing
+
+// ILayeredRing assigns several partition ranges at once: the layouts of a
+// cluster while its partitions are migrated to a new count, and the ranges of
+// the task types routed to the workers supporting them
+type ILayeredRing interface {
+	IHashRing
+	// SetRanges replaces the assigned ranges, the members are kept
+	SetRanges(ranges []Range)
+	// AddMember adds or updates a worker, AddNodes adds one without task types
+	AddMember(workerID types.WorkerID, m Member)
+	// Rebuild replaces the members, every range gets a new ring built from them
+	Rebuild(members map[types.WorkerID]Member)
+	// GetStandbyForPartition is the owner in another zone the partition fails
+	// over to, empty unless the rings are zone aware
+	GetStandbyForPartition(partitionID types.PartitionID) types.WorkerID
+}
+
+type layer struct {
+	Range
+	ring IHashRing
+}
+
+// Layered gives each range its own ring built by factory, partition First+i of
+// a range is partition i of its ring. A single range starting at 0 assigns
+// exactly like the ring alone
+type Layered struct {
+	factory Factory
+	layers  []layer
+	members map[types.WorkerID]Member
+
+	mu sync.RWMutex
+}
+
+func NewLayered(factory Factory, ranges ...Range) ILayeredRing {
+	l := &Layered{
+		factory: factory,
+		members: map[types.WorkerID]Member{},
+	}
+	l.SetRanges(ranges)
+	return l
+}
+
+func (l *Layered) SetRanges(ranges []Range) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	layers := make([]layer, 0, len(ranges))
+	for _, r := range ranges {
+		i := slices.IndexFunc(l.layers, func(existing layer) bool { return existing.Range == r })
+		if i >= 0 {
+			layers = append(layers, l.layers[i])
+			continue
+		}
+
+		layers = append(layers, layer{Range: r, ring: l.build(r)})
+	}
+
+	l.layers = layers
+}
+
+func (l *Layered) Rebuild(members map[types.WorkerID]Member) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.members = make(map[types.WorkerID]Member, len(members))
+	for workerID, m := range members {
+		l.members[workerID] = m
+	}
+
+	for i, layer := range l.layers {
+		l.layers[i].ring = l.build(layer.Range)
+	}
+}
+
+// build creates the ring of a range with the current members serving it
+func (l *Layered) build(r Range) IHashRing {
+	ring := l.factory(r.Count)
+	for workerID, m := range l.members {
+		if r.serves(m) {
+			add(ring, workerID, m)
+		}
+	}
+	return ring
+}
+
+// add puts the member in the ring, with its zone when the ring uses zones
+func add(ring IHashRing, workerID types.WorkerID, m Member) {
+	if zoned, ok := ring.(IZonedRing); ok {
+		zoned.AddZonedNode(workerID, m.Weight, m.Zone)
+		return
+	}
+	ring.AddNodes(workerID, m.Weight)
+}
+
+func (l *Layered) AddNodes(workerID types.WorkerID, weight int) {
+	l.AddMember(workerID, Member{Weight: weight})
+}
+
+func (l *Layered) AddMember(workerID types.WorkerID, m Member) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.members[workerID] = m
+	for _, layer := range l.layers {
+		// the task types of a member may have changed, it can leave a range
+		if layer.serves(m) {
+			add(layer.ring, workerID, m)
+		} else {
+			layer.ring.RemoveNode(workerID)
+		}
+	}
+}
+
+func (l *Layered) RemoveNode(workerID types.WorkerID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.members, workerID)
+	for _, layer := range l.layers {
+		layer.ring.RemoveNode(workerID)
+	}
+}
+
+func (l *Layered) GetNodeForPartition(partitionID types.PartitionID) types.WorkerID {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, layer := range l.layers {
+		if layer.contains(partitionID) {
+			return layer.ring.GetNodeForPartition(partitionID - layer.First)
+		}
+	}
+	return ""
+}
+
+func (l *Layered) GetStandbyForPartition(partitionID types.PartitionID) types.WorkerID {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, layer := range l.layers {
+		if !layer.contains(partitionID) {
+			continue
+		}
+		if zoned, ok := layer.ring.(IZonedRing); ok {
+			return zoned.GetStandbyForPartition(partitionID - layer.First)
+		}
+		return ""
+	}
+	return ""
+}
+
+func (l *Layered) FetchPartitionsForNode(workerID types.WorkerID) []types.PartitionID {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	partitions := make([]types.PartitionID, 0)
+	for _, layer := range l.layers {
+		for _, partitionID := range layer.ring.FetchPartitionsForNode(workerID) {
+			partitions = append(partitions, layer.First+partitionID)
+		}
+	}
+
+	return partitions
+}
+
+func (l *Layered) GetNodePartitions(workerID types.WorkerID) []types.PartitionID {
+	return l.FetchPartitionsForNode(workerID)
+}
@@ -0,0 +1,68 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"fmt"
+
+	"github.com/twmb/murmur3"
+)
+
+// maglevTableSize is the lookup table size, a prime much larger than the
+// number of workers so each gets a close to equal number of entries
+const maglevTableSize = 65537
+
+// assignMaglev builds the Maglev lookup table: each worker walks its own
+// permutation of the table (offset and skip from its id) and takes the next
+// free entry, in turns, until the table is full. A worker takes weight entries
+// per turn. Partitions are looked up by hash in the table
+func assignMaglev(members []member, partitions int) []types.WorkerID {
+	entries := maglevTable(members)
+
+	table := make([]types.WorkerID, partitions)
+	for partitionID := range partitions {
+		h := murmur3.Sum64([]byte(fmt.Sprintf("partition:%d", partitionID)))
+		table[partitionID] = members[entries[h%maglevTableSize]].workerID
+	}
+
+	return table
+}
+
+// maglevTable is the lookup table, the index in members of each entry owner
+func maglevTable(members []member) []int {
+	offsets := make([]uint64, len(members))
+	skips := make([]uint64, len(members))
+	next := make([]uint64, len(members))
+
+	for i, m := range members {
+		offsets[i] = murmur3.Sum64([]byte("maglev-offset:"+string(m.workerID))) % maglevTableSize
+		skips[i] = murmur3.Sum64([]byte("maglev-skip:"+string(m.workerID)))%(maglevTableSize-1) + 1
+	}
+
+	entries := make([]int, maglevTableSize)
+	for i := range entries {
+		entries[i] = -1
+	}
+
+	filled := 0
+	for filled < maglevTableSize {
+		for i, m := range members {
+			for range m.weight {
+				if filled == maglevTableSize {
+					break
+				}
+
+				slot := (offsets[i] + next[i]*skips[i]) % maglevTableSize
+				for entries[slot] >= 0 {
+					next[i]++
+					slot = (offsets[i] + next[i]*skips[i]) % maglevTableSize
+				}
+
+				entries[slot] = i
+				next[i]++
+				filled++
+			}
+		}
+	}
+
+	return entries
+}
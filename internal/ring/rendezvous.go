@@ -0,0 +1,36 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"fmt"
+	"math"
+
+	"github.com/twmb/murmur3"
+)
+
+// assignRendezvous scores every (partition, worker) pair and keeps the best
+// worker. Weights use the logarithmic method: score = weight / -ln(h), h the
+// pair hash mapped to (0, 1), so a worker wins a share proportional to its
+// weight and only the partitions of a leaving worker move
+func assignRendezvous(members []member, partitions int) []types.WorkerID {
+	table := make([]types.WorkerID, partitions)
+
+	for partitionID := range partitions {
+		best := math.Inf(-1)
+
+		for _, m := range members {
+			h := murmur3.Sum64([]byte(fmt.Sprintf("partition:%d|%s", partitionID, m.workerID)))
+			// top 53 bits, shifted by half a step so it is never 0 or 1
+			x := (float64(h>>11) + 0.5) / (1 << 53)
+
+			score := float64(m.weight) / -math.Log(x)
+			// members are sorted, ties go to the smallest id
+			if score > best {
+				best = score
+				table[partitionID] = m.workerID
+			}
+		}
+	}
+
+	return table
+}
@@ -0,0 +1,52 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"math"
+)
+
+// Balance tells how evenly the partitions are spread over the workers
+type Balance struct {
+	Min    int
+	Max    int
+	Mean   float64
+	StdDev float64
+	// MaxOverMean is the load of the busiest worker relative to a perfect split
+	MaxOverMean float64
+}
+
+func MeasureBalance(r IHashRing, workers []types.WorkerID, partitions int) Balance {
+	if len(workers) == 0 {
+		return Balance{}
+	}
+
+	b := Balance{
+		Min:  math.MaxInt,
+		Mean: float64(partitions) / float64(len(workers)),
+	}
+
+	variance := 0.0
+	for _, workerID := range workers {
+		load := len(r.FetchPartitionsForNode(workerID))
+
+		b.Min = min(b.Min, load)
+		b.Max = max(b.Max, load)
+		variance += math.Pow(float64(load)-b.Mean, 2)
+	}
+
+	b.StdDev = math.Sqrt(variance / float64(len(workers)))
+	b.MaxOverMean = float64(b.Max) / b.Mean
+
+	return b
+}
+
+// Moved counts the partitions that changed owner between two assignments
+func Moved(before, after IHashRing, partitions int) int {
+	moved := 0
+	for partitionID := range partitions {
+		if before.GetNodeForPartition(types.PartitionID(partitionID)) != after.GetNodeForPartition(types.PartitionID(partitionID)) {
+			moved++
+		}
+	}
+	return moved
+}
@@ -0,0 +1,149 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Strategy names a partition assignment algorithm. Every worker of a cluster
+// must use the same one, or they disagree on who owns what
+type Strategy string
+
+const (
+	// StrategyConsistent is the murmur3 vnode ring
+	StrategyConsistent Strategy = "consistent"
+	// StrategyRendezvous gives a partition to the worker with the highest hash
+	// of (partition, worker), highest random weight hashing
+	StrategyRendezvous Strategy = "rendezvous"
+	// StrategyJump is jump consistent hash over the workers sorted by id
+	StrategyJump Strategy = "jump"
+	// StrategyMaglev fills a Maglev lookup table with the workers permutations
+	StrategyMaglev Strategy = "maglev"
+)
+
+var Strategies = []Strategy{StrategyConsistent, StrategyRendezvous, StrategyJump, StrategyMaglev}
+
+func ParseStrategy(s string) (Strategy, error) {
+	strategy := Strategy(strings.ToLower(s))
+	if !slices.Contains(Strategies, strategy) {
+		return "", fmt.Errorf("ring: unknown strategy %q", s)
+	}
+	return strategy, nil
+}
+
+// New builds the assignment for a strategy. opts only apply to the consistent ring
+func New(strategy Strategy, partitions int, opts ...RingOption) (IHashRing, error) {
+	switch strategy {
+	case StrategyConsistent:
+		return NewConsistentHashRing(partitions, opts...), nil
+	case StrategyRendezvous:
+		return newTableRing(partitions, assignRendezvous), nil
+	case StrategyJump:
+		return newTableRing(partitions, assignJump), nil
+	case StrategyMaglev:
+		return newTableRing(partitions, assignMaglev), nil
+	}
+	return nil, fmt.Errorf("ring: unknown strategy %q", strategy)
+}
+
+// member is a worker with its capacity weight
+type member struct {
+	workerID types.WorkerID
+	weight   int
+}
+
+// assignFunc computes the owner of every partition. members are sorted by id,
+// so the result only depends on the membership
+type assignFunc func(members []member, partitions int) []types.WorkerID
+
+// tableRing keeps the membership and the partition -> worker table computed by
+// its strategy, rebuilt on every membership change
+type tableRing struct {
+	totalPartitions int
+	members         map[types.WorkerID]int
+	assign          assignFunc
+	table           []types.WorkerID
+
+	mu sync.RWMutex
+}
+
+func newTableRing(partitions int, assign assignFunc) IHashRing {
+	return &tableRing{
+		totalPartitions: partitions,
+		members:         map[types.WorkerID]int{},
+		assign:          assign,
+	}
+}
+
+func (t *tableRing) AddNodes(workerID types.WorkerID, weight int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	weight = min(max(weight, 1), types.MAX_WEIGHT)
+	if current, ok := t.members[workerID]; ok && current == weight {
+		return
+	}
+
+	t.members[workerID] = weight
+	t.rebuild()
+}
+
+func (t *tableRing) RemoveNode(workerID types.WorkerID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.members[workerID]; !ok {
+		return
+	}
+
+	delete(t.members, workerID)
+	t.rebuild()
+}
+
+func (t *tableRing) rebuild() {
+	if len(t.members) == 0 {
+		t.table = nil
+		return
+	}
+
+	members := make([]member, 0, len(t.members))
+	for workerID, weight := range t.members {
+		members = append(members, member{workerID: workerID, weight: weight})
+	}
+	slices.SortFunc(members, func(a, b member) int {
+		return strings.Compare(string(a.workerID), string(b.workerID))
+	})
+
+	t.table = t.assign(members, t.totalPartitions)
+}
+
+func (t *tableRing) GetNodeForPartition(partitionID types.PartitionID) types.WorkerID {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if int(partitionID) >= len(t.table) {
+		return ""
+	}
+	return t.table[partitionID]
+}
+
+func (t *tableRing) FetchPartitionsForNode(workerID types.WorkerID) []types.PartitionID {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	partitions := make([]types.PartitionID, 0)
+	for partitionID, owner := range t.table {
+		if owner == workerID {
+			partitions = append(partitions, types.PartitionID(partitionID))
+		}
+	}
+
+	return partitions
+}
+
+func (t *tableRing) GetNodePartitions(workerID types.WorkerID) []types.PartitionID {
+	return t.FetchPartitionsForNode(workerID)
+}
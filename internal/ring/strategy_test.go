@@ -0,0 +1,280 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"fmt"
+	"testing"
+)
+
+const testPartitions = 1024
+
+func workers(n int) []types.WorkerID {
+	ids := make([]types.WorkerID, 0, n)
+	for i := range n {
+		ids = append(ids, types.WorkerID(fmt.Sprintf("worker-%03d", i)))
+	}
+	return ids
+}
+
+func build(t *testing.T, s Strategy, ids []types.WorkerID) IHashRing {
+	t.Helper()
+
+	r, err := New(s, testPartitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workerID := range ids {
+		r.AddNodes(workerID, 1)
+	}
+	return r
+}
+
+func owners(r IHashRing) []types.WorkerID {
+	table := make([]types.WorkerID, testPartitions)
+	for partitionID := range testPartitions {
+		table[partitionID] = r.GetNodeForPartition(types.PartitionID(partitionID))
+	}
+	return table
+}
+
+func TestStrategiesAreDeterministic(t *testing.T) {
+	ids := workers(7)
+	reversed := make([]types.WorkerID, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		reversed = append(reversed, ids[i])
+	}
+
+	for _, s := range Strategies {
+		t.Run(string(s), func(t *testing.T) {
+			a := owners(build(t, s, ids))
+			b := owners(build(t, s, reversed))
+
+			for partitionID := range a {
+				if a[partitionID] != b[partitionID] {
+					t.Fatalf("partition %d: %s with one join order, %s with another", partitionID, a[partitionID], b[partitionID])
+				}
+			}
+		})
+	}
+}
+
+func TestStrategiesAssignEveryPartition(t *testing.T) {
+	ids := workers(5)
+
+	for _, s := range Strategies {
+		t.Run(string(s), func(t *testing.T) {
+			r := build(t, s, ids)
+
+			total := 0
+			for _, workerID := range ids {
+				n := len(r.FetchPartitionsForNode(workerID))
+				if n == 0 {
+					t.Fatalf("%s got no partition", workerID)
+				}
+				total += n
+			}
+			if total != testPartitions {
+				t.Fatalf("workers hold %d partitions, want %d", total, testPartitions)
+			}
+
+			for partitionID, owner := range owners(r) {
+				if owner == "" {
+					t.Fatalf("partition %d has no owner", partitionID)
+				}
+			}
+		})
+	}
+}
+
+func TestStrategiesEmptyAndOutOfRange(t *testing.T) {
+	for _, s := range Strategies {
+		t.Run(string(s), func(t *testing.T) {
+			r, err := New(s, testPartitions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owner := r.GetNodeForPartition(0); owner != "" {
+				t.Fatalf("empty ring gave partition 0 to %s", owner)
+			}
+
+			r.AddNodes("worker-000", 1)
+			r.RemoveNode("worker-000")
+			if owner := r.GetNodeForPartition(0); owner != "" {
+				t.Fatalf("ring emptied again gave partition 0 to %s", owner)
+			}
+		})
+	}
+
+	for _, s := range []Strategy{StrategyRendezvous, StrategyJump, StrategyMaglev} {
+		r := build(t, s, workers(3))
+		if owner := r.GetNodeForPartition(testPartitions); owner != "" {
+			t.Fatalf("%s: partition %d is outside the ring but went to %s", s, testPartitions, owner)
+		}
+	}
+}
+
+// movement checks how partitions move when the membership changes from
+// before to after
+type movement struct {
+	name   string
+	before []types.WorkerID
+	after  []types.WorkerID
+	// minimal means only partitions of a leaving worker, or going to a joining
+	// one, may move
+	minimal bool
+	// maxMoved bounds the moved partitions when the movement is not minimal
+	maxMoved int
+}
+
+func TestStrategiesMovement(t *testing.T) {
+	ten := workers(10)
+	eleven := workers(11)
+	withoutMiddle := append(append([]types.WorkerID{}, ten[:5]...), ten[6:]...)
+
+	// a tenth of the partitions is the least that can move
+	share := testPartitions / 10
+
+	tests := map[Strategy][]movement{
+		StrategyConsistent: {
+			{name: "join", before: ten, after: eleven, minimal: true},
+			{name: "leave", before: ten, after: withoutMiddle, minimal: true},
+		},
+		StrategyRendezvous: {
+			{name: "join", before: ten, after: eleven, minimal: true},
+			{name: "leave", before: ten, after: withoutMiddle, minimal: true},
+		},
+		StrategyJump: {
+			// the new worker sorts last, jump hash only adds a bucket at the end
+			{name: "join at the end", before: ten, after: eleven, minimal: true},
+			{name: "leave at the end", before: eleven, after: ten, minimal: true},
+			// removing a bucket from the middle shifts the ones after it
+			{name: "leave in the middle", before: ten, after: withoutMiddle, maxMoved: testPartitions},
+		},
+		StrategyMaglev: {
+			{name: "join", before: ten, after: eleven, maxMoved: 2 * share},
+			{name: "leave", before: ten, after: withoutMiddle, maxMoved: 2 * share},
+		},
+	}
+
+	for s, movements := range tests {
+		for _, tt := range movements {
+			t.Run(string(s)+"/"+tt.name, func(t *testing.T) {
+				before := owners(build(t, s, tt.before))
+				after := owners(build(t, s, tt.after))
+
+				members := map[types.WorkerID]bool{}
+				for _, workerID := range tt.before {
+					members[workerID] = true
+				}
+				stays := map[types.WorkerID]bool{}
+				for _, workerID := range tt.after {
+					stays[workerID] = true
+				}
+
+				moved := 0
+				for partitionID := range before {
+					if before[partitionID] == after[partitionID] {
+						continue
+					}
+					moved++
+
+					if tt.minimal && stays[before[partitionID]] && members[after[partitionID]] {
+						t.Fatalf("partition %d moved from %s to %s, neither joined nor left",
+							partitionID, before[partitionID], after[partitionID])
+					}
+				}
+
+				if tt.maxMoved > 0 && moved > tt.maxMoved {
+					t.Fatalf("%d partitions moved, want at most %d", moved, tt.maxMoved)
+				}
+				if moved == 0 {
+					t.Fatal("no partition moved")
+				}
+			})
+		}
+	}
+}
+
+func TestStrategiesFollowWeights(t *testing.T) {
+	for _, s := range Strategies {
+		t.Run(string(s), func(t *testing.T) {
+			r, err := New(s, testPartitions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := workers(4)
+			for _, workerID := range ids[:3] {
+				r.AddNodes(workerID, 1)
+			}
+			r.AddNodes(ids[3], 3)
+
+			light := len(r.FetchPartitionsForNode(ids[0])) + len(r.FetchPartitionsForNode(ids[1])) + len(r.FetchPartitionsForNode(ids[2]))
+			heavy := len(r.FetchPartitionsForNode(ids[3]))
+
+			// half of the capacity, give or take the hashing noise
+			if heavy < testPartitions*35/100 || heavy > testPartitions*65/100 {
+				t.Fatalf("weight 3 worker holds %d of %d partitions, the others %d", heavy, testPartitions, light)
+			}
+		})
+	}
+}
+
+func TestMaglevTableIsFull(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []member
+	}{
+		{"one worker", []member{{workerID: "a", weight: 1}}},
+		{"equal weights", []member{{workerID: "a", weight: 1}, {workerID: "b", weight: 1}, {workerID: "c", weight: 1}}},
+		{"mixed weights", []member{{workerID: "a", weight: 1}, {workerID: "b", weight: 4}, {workerID: "c", weight: types.MAX_WEIGHT}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := maglevTable(tt.members)
+			if len(entries) != maglevTableSize {
+				t.Fatalf("table has %d entries, want %d", len(entries), maglevTableSize)
+			}
+
+			counts := make([]int, len(tt.members))
+			for slot, owner := range entries {
+				if owner < 0 || owner >= len(tt.members) {
+					t.Fatalf("slot %d is not filled (%d)", slot, owner)
+				}
+				counts[owner]++
+			}
+
+			total := 0
+			for _, m := range tt.members {
+				total += m.weight
+			}
+			// Maglev gives each worker its share of the table within one turn
+			for i, m := range tt.members {
+				want := maglevTableSize * m.weight / total
+				if diff := counts[i] - want; diff < -total || diff > total {
+					t.Fatalf("%s holds %d entries, want about %d", m.workerID, counts[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestJumpHashBuckets(t *testing.T) {
+	for buckets := 1; buckets <= 64; buckets++ {
+		for key := range uint64(1000) {
+			b := jumpHash(key*0x9e3779b97f4a7c15, buckets)
+			if b < 0 || b >= buckets {
+				t.Fatalf("jumpHash gave bucket %d of %d", b, buckets)
+			}
+		}
+	}
+
+	// growing the buckets only moves keys to the new bucket
+	for key := range uint64(10000) {
+		k := key * 0x9e3779b97f4a7c15
+		before, after := jumpHash(k, 10), jumpHash(k, 11)
+		if before != after && after != 10 {
+			t.Fatalf("key %d moved from bucket %d to %d", k, before, after)
+		}
+	}
+}
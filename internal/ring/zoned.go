@@ -0,0 +1,198 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/twmb/murmur3"
+)
+
+// IZonedRing is a ring that knows the zone of its members
+type IZonedRing interface {
+	IHashRing
+	// AddZonedNode adds or updates a worker of the zone, AddNodes adds one of the "" zone
+	AddZonedNode(workerID types.WorkerID, weight int, zone string)
+	// GetStandbyForPartition is the worker, in another zone, the partition
+	// moves to if the zone of its owner is lost. Empty with a single zone
+	GetStandbyForPartition(partitionID types.PartitionID) types.WorkerID
+}
+
+type zonedMember struct {
+	weight int
+	zone   string
+}
+
+// Zoned splits the partitions between zones in proportion to their capacity
+// (the weights of their workers), then between the workers of each zone with
+// the ring built by factory. Losing a zone strands only its partitions.
+//
+// Zones are picked with weighted rendezvous over the workers, so a worker
+// joining, leaving or changing zone only moves partitions into or out of its
+// zones, and the standby is exactly the owner the partition gets once the zone
+// of its owner is gone
+type Zoned struct {
+	partitions int
+	factory    Factory
+	members    map[types.WorkerID]zonedMember
+	zones      map[string]IHashRing
+
+	owners  []types.WorkerID
+	standby []types.WorkerID
+
+	mu sync.RWMutex
+}
+
+func NewZoned(partitions int, factory Factory) IZonedRing {
+	return &Zoned{
+		partitions: partitions,
+		factory:    factory,
+		members:    map[types.WorkerID]zonedMember{},
+		zones:      map[string]IHashRing{},
+	}
+}
+
+func (z *Zoned) AddNodes(workerID types.WorkerID, weight int) {
+	z.AddZonedNode(workerID, weight, "")
+}
+
+func (z *Zoned) AddZonedNode(workerID types.WorkerID, weight int, zone string) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	m := zonedMember{weight: min(max(weight, 1), types.MAX_WEIGHT), zone: zone}
+	if current, ok := z.members[workerID]; ok {
+		if current == m {
+			return
+		}
+		delete(z.members, workerID)
+		z.leaveZone(workerID, current.zone)
+	}
+
+	z.members[workerID] = m
+
+	ring, ok := z.zones[zone]
+	if !ok {
+		ring = z.factory(z.partitions)
+		z.zones[zone] = ring
+	}
+	ring.AddNodes(workerID, m.weight)
+
+	z.assign()
+}
+
+func (z *Zoned) RemoveNode(workerID types.WorkerID) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	m, ok := z.members[workerID]
+	if !ok {
+		return
+	}
+
+	delete(z.members, workerID)
+	z.leaveZone(workerID, m.zone)
+	z.assign()
+}
+
+// leaveZone removes the worker from its zone ring, and the zone once empty
+func (z *Zoned) leaveZone(workerID types.WorkerID, zone string) {
+	z.zones[zone].RemoveNode(workerID)
+
+	for _, m := range z.members {
+		if m.zone == zone {
+			return
+		}
+	}
+	delete(z.zones, zone)
+}
+
+// assign picks the zone of every partition, and of its standby, with weighted
+// rendezvous over the workers: the zone of the best scoring worker owns the
+// partition, the zone of the best scoring worker of another zone is the
+// standby. The zone ring then picks the worker within the zone
+func (z *Zoned) assign() {
+	workers := slices.Sorted(maps.Keys(z.members))
+
+	z.owners = make([]types.WorkerID, z.partitions)
+	z.standby = make([]types.WorkerID, z.partitions)
+
+	for partitionID := range z.partitions {
+		owner, standby := "", ""
+		ownerScore, standbyScore := math.Inf(-1), math.Inf(-1)
+
+		for _, workerID := range workers {
+			m := z.members[workerID]
+			score := zoneScore(partitionID, workerID, m.weight)
+
+			// workers are sorted, ties go to the smallest id
+			switch {
+			case score > ownerScore:
+				if m.zone != owner {
+					standby, standbyScore = owner, ownerScore
+				}
+				owner, ownerScore = m.zone, score
+			case m.zone != owner && score > standbyScore:
+				standby, standbyScore = m.zone, score
+			}
+		}
+
+		// "" is a zone too, an infinite score means none was found
+		if !math.IsInf(ownerScore, -1) {
+			z.owners[partitionID] = z.zones[owner].GetNodeForPartition(types.PartitionID(partitionID))
+		}
+		if !math.IsInf(standbyScore, -1) {
+			z.standby[partitionID] = z.zones[standby].GetNodeForPartition(types.PartitionID(partitionID))
+		}
+	}
+}
+
+// zoneScore is the logarithmic weighted rendezvous score of assignRendezvous.
+// It does not depend on the zone, a worker changing zone only takes the
+// partitions it wins from its old zone to the new one
+func zoneScore(partitionID int, workerID types.WorkerID, weight int) float64 {
+	h := murmur3.Sum64([]byte(fmt.Sprintf("partition:%d|zone-worker:%s", partitionID, workerID)))
+	x := (float64(h>>11) + 0.5) / (1 << 53)
+
+	return float64(weight) / -math.Log(x)
+}
+
+func (z *Zoned) GetNodeForPartition(partitionID types.PartitionID) types.WorkerID {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	if int(partitionID) >= len(z.owners) {
+		return ""
+	}
+	return z.owners[partitionID]
+}
+
+func (z *Zoned) GetStandbyForPartition(partitionID types.PartitionID) types.WorkerID {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	if int(partitionID) >= len(z.standby) {
+		return ""
+	}
+	return z.standby[partitionID]
+}
+
+func (z *Zoned) FetchPartitionsForNode(workerID types.WorkerID) []types.PartitionID {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	partitions := make([]types.PartitionID, 0)
+	for partitionID, owner := range z.owners {
+		if owner == workerID {
+			partitions = append(partitions, types.PartitionID(partitionID))
+		}
+	}
+	return partitions
+}
+
+func (z *Zoned) GetNodePartitions(workerID types.WorkerID) []types.PartitionID {
+	return z.FetchPartitionsForNode(workerID)
+}
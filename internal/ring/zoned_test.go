@@ -0,0 +1,232 @@
+package ring
+
+import (
+	"dtq/internal/types"
+	"fmt"
+	"math"
+	"testing"
+)
+
+type zonedWorker struct {
+	id     types.WorkerID
+	weight int
+	zone   string
+}
+
+func zonedRing(t *testing.T, s Strategy, members []zonedWorker) IZonedRing {
+	t.Helper()
+
+	if _, err := New(s, testPartitions); err != nil {
+		t.Fatal(err)
+	}
+	r := NewZoned(testPartitions, func(partitions int) IHashRing {
+		inner, _ := New(s, partitions)
+		return inner
+	})
+	for _, m := range members {
+		r.AddZonedNode(m.id, m.weight, m.zone)
+	}
+	return r
+}
+
+// spread puts n workers of the given weight in each zone
+func spread(zones map[string]int, weight int) []zonedWorker {
+	members := make([]zonedWorker, 0)
+	for zone, n := range zones {
+		for i := range n {
+			members = append(members, zonedWorker{id: types.WorkerID(fmt.Sprintf("%s-worker-%d", zone, i)), weight: weight, zone: zone})
+		}
+	}
+	return members
+}
+
+func zoneOf(members []zonedWorker) map[types.WorkerID]string {
+	zones := make(map[types.WorkerID]string, len(members))
+	for _, m := range members {
+		zones[m.id] = m.zone
+	}
+	return zones
+}
+
+func TestZonedSplitsByWeight(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []zonedWorker
+	}{
+		{"equal zones", spread(map[string]int{"a": 2, "b": 2, "c": 2}, 1)},
+		{"uneven worker counts", spread(map[string]int{"a": 1, "b": 2, "c": 5}, 1)},
+		{"weights", []zonedWorker{
+			{"a-1", 10, "a"},
+			{"b-1", 1, "b"}, {"b-2", 2, "b"},
+			{"c-1", 4, "c"},
+		}},
+		{"two zones 10:1", []zonedWorker{{"a-1", 10, "a"}, {"b-1", 1, "b"}}},
+		{"single zone", spread(map[string]int{"a": 3}, 2)},
+	}
+
+	for _, tt := range tests {
+		for _, s := range Strategies {
+			t.Run(tt.name+"/"+string(s), func(t *testing.T) {
+				r := zonedRing(t, s, tt.members)
+				zones := zoneOf(tt.members)
+
+				weights := map[string]int{}
+				total := 0
+				for _, m := range tt.members {
+					weights[m.zone] += m.weight
+					total += m.weight
+				}
+
+				owned := map[string]int{}
+				for partitionID, owner := range owners(r) {
+					zone, ok := zones[owner]
+					if !ok {
+						t.Fatalf("partition %d has owner %q, not a member", partitionID, owner)
+					}
+					owned[zone]++
+				}
+
+				// rendezvous splits in proportion to the weights, give or
+				// take 5% of the partitions
+				for zone, weight := range weights {
+					share := float64(testPartitions) * float64(weight) / float64(total)
+					if diff := math.Abs(float64(owned[zone]) - share); diff > 0.05*testPartitions {
+						t.Fatalf("zone %s (weight %d of %d) owns %d partitions, want about %.1f", zone, weight, total, owned[zone], share)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestZonedStandby(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []zonedWorker
+	}{
+		{"three zones", spread(map[string]int{"a": 2, "b": 3, "c": 1}, 1)},
+		{"two zones", spread(map[string]int{"a": 1, "b": 1}, 1)},
+		{"weighted", []zonedWorker{{"a-1", 10, "a"}, {"b-1", 1, "b"}, {"c-1", 3, "c"}, {"c-2", 3, "c"}}},
+	}
+
+	for _, tt := range tests {
+		for _, s := range Strategies {
+			t.Run(tt.name+"/"+string(s), func(t *testing.T) {
+				r := zonedRing(t, s, tt.members)
+				zones := zoneOf(tt.members)
+
+				for partitionID := range testPartitions {
+					p := types.PartitionID(partitionID)
+					owner, standby := r.GetNodeForPartition(p), r.GetStandbyForPartition(p)
+
+					if owner == "" || standby == "" {
+						t.Fatalf("partition %d has owner %q and standby %q", partitionID, owner, standby)
+					}
+					if zones[owner] == zones[standby] {
+						t.Fatalf("partition %d: owner %s and standby %s are both in zone %s", partitionID, owner, standby, zones[owner])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestZonedStandbyIsTheFailoverOwner(t *testing.T) {
+	members := spread(map[string]int{"a": 2, "b": 2, "c": 2}, 1)
+	zones := zoneOf(members)
+
+	for _, s := range Strategies {
+		for _, lost := range []string{"a", "b", "c"} {
+			t.Run(string(s)+"/lose "+lost, func(t *testing.T) {
+				r := zonedRing(t, s, members)
+
+				survivors := make([]zonedWorker, 0, len(members))
+				for _, m := range members {
+					if m.zone != lost {
+						survivors = append(survivors, m)
+					}
+				}
+				failover := zonedRing(t, s, survivors)
+
+				for partitionID := range testPartitions {
+					p := types.PartitionID(partitionID)
+					if zones[r.GetNodeForPartition(p)] != lost {
+						continue
+					}
+					if got, want := failover.GetNodeForPartition(p), r.GetStandbyForPartition(p); got != want {
+						t.Fatalf("partition %d failed over to %s, the standby was %s", partitionID, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestZonedSingleZoneHasNoStandby(t *testing.T) {
+	r := zonedRing(t, StrategyConsistent, spread(map[string]int{"a": 3}, 1))
+
+	for partitionID := range testPartitions {
+		if standby := r.GetStandbyForPartition(types.PartitionID(partitionID)); standby != "" {
+			t.Fatalf("partition %d has standby %s with a single zone", partitionID, standby)
+		}
+	}
+	if owner := r.GetNodeForPartition(testPartitions); owner != "" {
+		t.Fatalf("partition %d is outside the ring but went to %s", testPartitions, owner)
+	}
+}
+
+func TestZonedMoveShiftsOnlyTheZonesInvolved(t *testing.T) {
+	members := spread(map[string]int{"a": 3, "b": 3, "c": 3, "d": 3}, 1)
+
+	for _, s := range Strategies {
+		t.Run(string(s), func(t *testing.T) {
+			r := zonedRing(t, s, members)
+			before := owners(r)
+			zonesBefore := zoneOf(members)
+
+			// a-worker-0 moves to zone b, same weight
+			r.AddZonedNode("a-worker-0", 1, "b")
+			after := owners(r)
+			zonesAfter := zoneOf(members)
+			zonesAfter["a-worker-0"] = "b"
+
+			involved := map[string]bool{"a": true, "b": true}
+			for partitionID := range before {
+				from, to := zonesBefore[before[partitionID]], zonesAfter[after[partitionID]]
+				if (!involved[from] || !involved[to]) && before[partitionID] != after[partitionID] {
+					t.Fatalf("partition %d moved from %s (zone %s) to %s (zone %s), outside the zones involved",
+						partitionID, before[partitionID], from, after[partitionID], to)
+				}
+			}
+
+			// moving back restores the assignment
+			r.AddZonedNode("a-worker-0", 1, "a")
+			for partitionID, owner := range owners(r) {
+				if owner != before[partitionID] {
+					t.Fatalf("partition %d is on %s after moving back, it was on %s", partitionID, owner, before[partitionID])
+				}
+			}
+		})
+	}
+}
+
+func TestZonedEmptyZoneIsRemoved(t *testing.T) {
+	r := zonedRing(t, StrategyRendezvous, []zonedWorker{{"a-1", 1, "a"}, {"b-1", 1, "b"}})
+
+	// b-1 leaves zone b empty, zone a must take every partition
+	r.AddZonedNode("b-1", 1, "a")
+	for partitionID, owner := range owners(r) {
+		if owner == "" {
+			t.Fatalf("partition %d has no owner after its zone emptied", partitionID)
+		}
+	}
+	if standby := r.GetStandbyForPartition(0); standby != "" {
+		t.Fatalf("a single zone is left but partition 0 has standby %s", standby)
+	}
+
+	r.RemoveNode("a-1")
+	r.RemoveNode("b-1")
+	if owner := r.GetNodeForPartition(0); owner != "" {
+		t.Fatalf("empty ring gave partition 0 to %s", owner)
+	}
+}
@@ -0,0 +1,145 @@
+package task
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// binaryMagic is the first byte of every binary envelope. It can never start
+// a json object or a printable task id
+const binaryMagic byte = 0xb7
+
+// BinaryCodec is a compact length prefixed encoding:
+//
+//	magic | version | id | type | payload | headers count | (key | value)... | enqueued_at | attempt
+//
+// strings and byte slices are uvarint length prefixed, enqueued_at is unix nanos as varint
+type BinaryCodec struct{}
+
+func (BinaryCodec) Name() string {
+	return "binary"
+}
+
+func (BinaryCodec) Encode(t *Task) ([]byte, error) {
+	if t.Version == 0 {
+		t.Version = CurrentVersion
+	}
+
+	buf := make([]byte, 0, 32+len(t.ID)+len(t.Type)+len(t.Payload))
+	buf = append(buf, binaryMagic, t.Version)
+	buf = appendBytes(buf, []byte(t.ID))
+	buf = appendBytes(buf, []byte(t.Type))
+	buf = appendBytes(buf, t.Payload)
+
+	// sorted so the same task always encodes to the same bytes
+	keys := make([]string, 0, len(t.Headers))
+	for k := range t.Headers {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	buf = binary.AppendUvarint(buf, uint64(len(keys)))
+	for _, k := range keys {
+		buf = appendBytes(buf, []byte(k))
+		buf = appendBytes(buf, []byte(t.Headers[k]))
+	}
+
+	var enqueuedAt int64
+	if !t.EnqueuedAt.IsZero() {
+		enqueuedAt = t.EnqueuedAt.UnixNano()
+	}
+	buf = binary.AppendVarint(buf, enqueuedAt)
+	buf = binary.AppendUvarint(buf, uint64(t.Attempt))
+
+	return buf, nil
+}
+
+func (BinaryCodec) Decode(data []byte) (*Task, error) {
+	if len(data) < 2 || data[0] != binaryMagic {
+		return nil, ErrMalformed
+	}
+
+	t := &Task{Version: data[1], Headers: map[string]string{}}
+	if err := checkVersion(t.Version); err != nil {
+		return nil, err
+	}
+
+	r := reader{buf: data[2:]}
+
+	t.ID = string(r.bytes())
+	t.Type = string(r.bytes())
+	if payload := r.bytes(); len(payload) > 0 {
+		t.Payload = payload
+	}
+
+	headers := r.uvarint()
+	for i := uint64(0); i < headers && r.err == nil; i++ {
+		k := string(r.bytes())
+		t.Headers[k] = string(r.bytes())
+	}
+
+	if nanos := r.varint(); nanos != 0 {
+		t.EnqueuedAt = time.Unix(0, nanos).UTC()
+	}
+	t.Attempt = int(r.uvarint())
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return t, nil
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// reader keeps the first error so decoding reads straight through
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = fmt.Errorf("%w: bad uvarint", ErrMalformed)
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = fmt.Errorf("%w: bad varint", ErrMalformed)
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	size := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if size > uint64(len(r.buf)) {
+		r.err = fmt.Errorf("%w: truncated field", ErrMalformed)
+		return nil
+	}
+	b := make([]byte, size)
+	copy(b, r.buf[:size])
+	r.buf = r.buf[size:]
+	return b
+}
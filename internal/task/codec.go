@@ -0,0 +1,77 @@
+package task
+
+import "fmt"
+
+// Codec turns a task into the bytes stored in redis and back
+type Codec interface {
+	Name() string
+	Encode(t *Task) ([]byte, error)
+	Decode(data []byte) (*Task, error)
+}
+
+var codecs = map[string]Codec{
+	JSONCodec{}.Name():   JSONCodec{},
+	BinaryCodec{}.Name(): BinaryCodec{},
+}
+
+func CodecByName(name string) (Codec, error) {
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("task: unknown codec %q", name)
+	}
+	return c, nil
+}
+
+// Decode detects the codec from the first byte, so producers can use any codec
+// without workers being configured for it. A bare task id pushed by the old
+// producers (see legacyID) is accepted too, anything else is malformed
+func Decode(data []byte) (*Task, error) {
+	if len(data) == 0 {
+		return nil, ErrMalformed
+	}
+
+	switch data[0] {
+	case binaryMagic:
+		return BinaryCodec{}.Decode(data)
+	case '{':
+		return JSONCodec{}.Decode(data)
+	}
+
+	if !legacyID(data) {
+		return nil, ErrMalformed
+	}
+
+	return &Task{ID: string(data), Headers: map[string]string{}}, nil
+}
+
+// maxLegacyID bounds a bare task id, the old producers wrote ids like
+// "send-email-2-instance-42", uuids or ulids
+const maxLegacyID = 128
+
+// legacyID tells whether data looks like a task id of the old producers: an
+// ascii letter or digit followed by letters, digits and - _ . :
+func legacyID(data []byte) bool {
+	if len(data) > maxLegacyID || !isAlnum(data[0]) {
+		return false
+	}
+
+	for _, c := range data {
+		if !isAlnum(c) && c != '-' && c != '_' && c != '.' && c != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// CodecOf returns the codec data was encoded with, so a task can be written back
+// the way its producer wrote it. Legacy bare ids are upgraded to json
+func CodecOf(data []byte) Codec {
+	if len(data) > 0 && data[0] == binaryMagic {
+		return BinaryCodec{}
+	}
+	return JSONCodec{}
+}
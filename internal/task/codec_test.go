@@ -0,0 +1,169 @@
+package task
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	enqueuedAt := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+
+	tasks := []struct {
+		name string
+		task Task
+	}{
+		{
+			name: "full",
+			task: Task{
+				ID:         "0123456789abcdef",
+				Type:       "email.send",
+				Payload:    []byte(`{"to":"someone@example.com"}`),
+				Headers:    map[string]string{HeaderPartitionKey: "tenant-1", "trace": "abc"},
+				EnqueuedAt: enqueuedAt,
+				Attempt:    3,
+				Version:    CurrentVersion,
+			},
+		},
+		{
+			name: "empty fields",
+			task: Task{
+				ID:      "id",
+				Headers: map[string]string{},
+				Version: CurrentVersion,
+			},
+		},
+		{
+			name: "binary payload",
+			task: Task{
+				ID:         "id",
+				Type:       "blob",
+				Payload:    []byte{0x00, 0xff, binaryMagic, '{', '\n'},
+				Headers:    map[string]string{"": ""},
+				EnqueuedAt: enqueuedAt,
+				Version:    CurrentVersion,
+			},
+		},
+	}
+
+	for _, codec := range []Codec{JSONCodec{}, BinaryCodec{}} {
+		for _, tt := range tasks {
+			t.Run(codec.Name()+"/"+tt.name, func(t *testing.T) {
+				in := tt.task
+				data, err := codec.Encode(&in)
+				if err != nil {
+					t.Fatalf("encode: %v", err)
+				}
+
+				out, err := codec.Decode(data)
+				if err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if !reflect.DeepEqual(*out, tt.task) {
+					t.Fatalf("round trip mismatch\n got: %+v\nwant: %+v", *out, tt.task)
+				}
+
+				// Decode must detect the codec on its own
+				detected, err := Decode(data)
+				if err != nil {
+					t.Fatalf("detect: %v", err)
+				}
+				if !reflect.DeepEqual(*detected, tt.task) {
+					t.Fatalf("detected codec mismatch\n got: %+v\nwant: %+v", *detected, tt.task)
+				}
+				if CodecOf(data).Name() != codec.Name() {
+					t.Fatalf("CodecOf = %s, want %s", CodecOf(data).Name(), codec.Name())
+				}
+			})
+		}
+	}
+}
+
+func TestEncodeSetsVersion(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec{}, BinaryCodec{}} {
+		data, err := codec.Encode(&Task{ID: "id"})
+		if err != nil {
+			t.Fatalf("%s: encode: %v", codec.Name(), err)
+		}
+		out, err := codec.Decode(data)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", codec.Name(), err)
+		}
+		if out.Version != CurrentVersion {
+			t.Fatalf("%s: version = %d, want %d", codec.Name(), out.Version, CurrentVersion)
+		}
+	}
+}
+
+func TestBinaryEncodingIsDeterministic(t *testing.T) {
+	task := &Task{ID: "id", Headers: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}}
+
+	first, _ := BinaryCodec{}.Encode(task)
+	for range 20 {
+		again, _ := BinaryCodec{}.Encode(task)
+		if string(again) != string(first) {
+			t.Fatal("the same task encoded to different bytes")
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	full, _ := BinaryCodec{}.Encode(&Task{ID: "id", Type: "type", Payload: []byte("payload")})
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrMalformed},
+		{"control characters", []byte("id\x01"), ErrMalformed},
+		{"garbage", []byte("\x8f\x00\xa3garbage"), ErrMalformed},
+		{"non ascii", []byte("tâche-1"), ErrMalformed},
+		{"whitespace", []byte("send email"), ErrMalformed},
+		{"trailing newline", []byte("task-1\n"), ErrMalformed},
+		{"foreign payload", []byte("<xml>task</xml>"), ErrMalformed},
+		{"json array", []byte(`["id"]`), ErrMalformed},
+		{"leading dash", []byte("-task"), ErrMalformed},
+		{"id too long", []byte(strings.Repeat("a", maxLegacyID+1)), ErrMalformed},
+		{"bad json", []byte(`{"id":`), ErrMalformed},
+		{"json version 0", []byte(`{"id":"x","v":0}`), ErrUnsupportedVersion},
+		{"json future version", []byte(`{"id":"x","v":99}`), ErrUnsupportedVersion},
+		{"binary without version", []byte{binaryMagic}, ErrMalformed},
+		{"binary future version", []byte{binaryMagic, 99}, ErrUnsupportedVersion},
+		{"binary truncated", full[:len(full)-4], ErrMalformed},
+		{"binary length past the end", []byte{binaryMagic, CurrentVersion, 0x7f, 'a'}, ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); !errors.Is(err, tt.want) {
+				t.Fatalf("Decode(%q) error = %v, want %v", tt.data, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLegacyID(t *testing.T) {
+	ids := []string{
+		"legacy-task-42",
+		"send-email-2-instance-1999",
+		"0f8fad5b-d9cb-469f-a165-70867728950e",
+		"01ARZ3NDEKTSV4RRFFQ69G5FAV",
+		"tenant.1:job_7",
+	}
+
+	for _, id := range ids {
+		out, err := Decode([]byte(id))
+		if err != nil {
+			t.Fatalf("decode %q: %v", id, err)
+		}
+		if out.ID != id || out.PartitionKey() != id || out.Type != "" {
+			t.Fatalf("legacy id %q decoded as %+v", id, out)
+		}
+	}
+	if CodecOf([]byte("legacy-task-42")).Name() != "json" {
+		t.Fatal("legacy ids must be upgraded to json")
+	}
+}
@@ -0,0 +1,36 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Encode(t *Task) ([]byte, error) {
+	if t.Version == 0 {
+		t.Version = CurrentVersion
+	}
+	return json.Marshal(t)
+}
+
+func (JSONCodec) Decode(data []byte) (*Task, error) {
+	var t Task
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	if err := checkVersion(t.Version); err != nil {
+		return nil, err
+	}
+
+	if t.Headers == nil {
+		t.Headers = map[string]string{}
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,70 @@
+package task
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CurrentVersion is the envelope schema version written by this code
+const CurrentVersion uint8 = 1
+
+var (
+	ErrUnsupportedVersion = errors.New("task: unsupported envelope version")
+	ErrMalformed          = errors.New("task: malformed envelope")
+)
+
+// Task is the envelope pushed into the partition lists
+type Task struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Payload    []byte            `json:"payload,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	EnqueuedAt time.Time         `json:"enqueued_at"`
+	Attempt    int               `json:"attempt"`
+	Version    uint8             `json:"v"`
+}
+
+func New(taskType string, payload []byte) *Task {
+	return &Task{
+		ID:         NewID(),
+		Type:       taskType,
+		Payload:    payload,
+		Headers:    map[string]string{},
+		EnqueuedAt: time.Now().UTC(),
+		Version:    CurrentVersion,
+	}
+}
+
+// NewID returns a random 128 bit hex id
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("task: reading random id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func (t *Task) String() string {
+	return fmt.Sprintf("%s(%s)", t.Type, t.ID)
+}
+
+func checkVersion(v uint8) error {
+	if v == 0 || v > CurrentVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, v)
+	}
+	return nil
+}
+
+// HeaderPartitionKey holds the key used to pick the partition when it is not the task id
+const HeaderPartitionKey = "dtq-partition-key"
+
+// PartitionKey is the key the producer hashed to choose the task partition
+func (t *Task) PartitionKey() string {
+	if key := t.Headers[HeaderPartitionKey]; key != "" {
+		return key
+	}
+	return t.ID
+}
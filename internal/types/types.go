@@ -4,4 +4,17 @@ var NODE_ID = ""
 
 type WorkerID string
 
+// PartitionID identifies a partition. Each layout of the cluster (and each
+// routed task type) owns the ids [First, First+Partitions) of its range in the
+// cluster metadata, the first layout starts at 0
+type PartitionID uint32
+
+// NUM_VNODES is the number of vnodes per unit of worker weight
 const NUM_VNODES = 120
+
+// MAX_WEIGHT bounds a worker capacity weight, and so its vnodes
+const MAX_WEIGHT = 100
+
+// NUM_PARTITIONS is the default number of tasks:N lists, the count of a cluster
+// is kept in its etcd metadata (internal/cluster)
+const NUM_PARTITIONS = 256
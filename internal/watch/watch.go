@@ -0,0 +1,174 @@
+package watch
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+// reasons a watch stream is restarted
+const (
+	// ReasonCompacted is a watch starting at a revision etcd already compacted,
+	// the events in between are lost so the prefix is listed again
+	ReasonCompacted = "compacted"
+	// ReasonCanceled is a watch canceled by the server, e.g. it lost its leader
+	ReasonCanceled = "canceled"
+	// ReasonClosed is the watch channel closed without a response saying why
+	ReasonClosed = "closed"
+	// ReasonList is a failed listing of the prefix
+	ReasonList = "list"
+)
+
+const (
+	minBackoff = 200 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+// Handler keeps some state in sync with a prefix
+type Handler struct {
+	// Reset replaces the whole state with a listing of the prefix
+	Reset func(kvs []*mvccpb.KeyValue)
+	// Apply handles one event, in revision order
+	Apply func(event *etcd.Event)
+}
+
+// Reporter is told about the health of the watch, metrics.IMetrics implements it
+type Reporter interface {
+	SetWatchHealthy(watch string, healthy bool)
+	IncrWatchRestarts(watch string, reason string)
+}
+
+// Watcher follows a prefix and survives what a plain etcd watch does not: a
+// closed channel, a canceled stream or a compacted revision. It resumes from
+// the revision after the last event it handled, so no event is missed or
+// applied twice, and lists the prefix again when those events are gone
+type Watcher struct {
+	etcd     *etcd.Client
+	name     string
+	prefix   string
+	handler  Handler
+	reporter Reporter
+}
+
+type IWatcher interface {
+	// Run watches from fromRevision until ctx is done. Zero lists the prefix first
+	Run(ctx context.Context, fromRevision int64)
+}
+
+// NewWatcher builds a watcher of prefix, name labels its logs and metrics.
+// reporter may be nil
+func NewWatcher(etcdCli *etcd.Client, name, prefix string, handler Handler, reporter Reporter) IWatcher {
+	return &Watcher{
+		etcd:     etcdCli,
+		name:     name,
+		prefix:   prefix,
+		handler:  handler,
+		reporter: reporter,
+	}
+}
+
+func (w *Watcher) Run(ctx context.Context, fromRevision int64) {
+	revision := fromRevision
+	backoff := minBackoff
+
+	for ctx.Err() == nil {
+		reason := ReasonList
+
+		if revision == 0 {
+			revision = w.list(ctx)
+		}
+		if revision != 0 {
+			var handled bool
+			reason, handled = w.watch(ctx, &revision)
+			if handled {
+				backoff = minBackoff
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		if reason == ReasonCompacted {
+			revision = 0
+		}
+
+		w.setHealthy(false)
+		if w.reporter != nil {
+			w.reporter.IncrWatchRestarts(w.name, reason)
+		}
+		slog.Warn("watch interrupted, restarting", "watch", w.name, "reason", reason, "revision", revision, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+
+	w.setHealthy(false)
+}
+
+// list resets the handler with the prefix and returns the revision to watch
+// from, zero when the listing failed
+func (w *Watcher) list(ctx context.Context) int64 {
+	resp, err := w.etcd.Get(ctx, w.prefix, etcd.WithPrefix())
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("error listing watched prefix", "watch", w.name, "error", err)
+		}
+		return 0
+	}
+
+	slog.Info("watched prefix listed", "watch", w.name, "keys", len(resp.Kvs), "revision", resp.Header.Revision)
+	w.handler.Reset(resp.Kvs)
+
+	return resp.Header.Revision + 1
+}
+
+// watch applies events until the stream ends and tells why it ended. revision
+// follows the handled events, handled is true when the stream delivered anything
+func (w *Watcher) watch(ctx context.Context, revision *int64) (string, bool) {
+	// without a leader the member serving us is partitioned from the cluster,
+	// the stream is canceled instead of going silent
+	watchCtx, cancel := context.WithCancel(etcd.WithRequireLeader(ctx))
+	defer cancel()
+
+	watchCh := w.etcd.Watch(watchCtx, w.prefix, etcd.WithPrefix(), etcd.WithRev(*revision), etcd.WithProgressNotify())
+	w.setHealthy(true)
+
+	handled := false
+	for resp := range watchCh {
+		handled = true
+
+		if resp.CompactRevision != 0 {
+			slog.Warn("watch revision compacted", "watch", w.name, "revision", *revision, "compacted", resp.CompactRevision)
+			return ReasonCompacted, handled
+		}
+		if resp.Canceled {
+			slog.Warn("watch canceled", "watch", w.name, "error", resp.Err())
+			return ReasonCanceled, handled
+		}
+
+		for _, event := range resp.Events {
+			w.handler.Apply(event)
+			*revision = event.Kv.ModRevision + 1
+		}
+
+		// nothing changed on the prefix up to the header revision
+		if resp.IsProgressNotify() {
+			*revision = max(*revision, resp.Header.Revision+1)
+		}
+	}
+
+	return ReasonClosed, handled
+}
+
+func (w *Watcher) setHealthy(healthy bool) {
+	if w.reporter != nil {
+		w.reporter.SetWatchHealthy(w.name, healthy)
+	}
+}
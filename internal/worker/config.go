@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"dtq/internal/queue"
+	"dtq/internal/types"
+	"time"
+)
+
+type Config struct {
+	// Partitions is the partition count, it must match the cluster metadata in etcd
+	Partitions int
+	// ReliableQueue keeps popped tasks in a per worker processing list until they are acked.
+	// When false tasks are popped with BLPOP and lost if the worker dies mid task
+	ReliableQueue bool
+	// Ordered consumes each partition sequentially, in list order, even across rebalances
+	Ordered bool
+	// PartitionLockTTL is how long an ordered partition stays locked by a worker that stopped refreshing it
+	PartitionLockTTL time.Duration
+	// Concurrency is the number of tasks handled at the same time
+	Concurrency int
+	// Prefetch is how many fetched tasks may wait for a free handler
+	Prefetch int
+	// HandlerTimeout cancels a handler running longer than this, zero means no limit
+	HandlerTimeout time.Duration
+	// DrainTimeout is how long in-flight tasks may keep running after a rebalance or shutdown
+	DrainTimeout time.Duration
+	// PollInterval is how long the reliable queue waits when all owned partitions are empty
+	PollInterval time.Duration
+	// Priorities sets how the high, default and low lists of a partition are consumed
+	Priorities queue.PriorityPolicy
+	// ReapInterval is how often in-flight tasks of dead workers are returned to their partitions
+	ReapInterval time.Duration
+	// PromoteInterval is how often due delayed tasks and retries of owned partitions are moved to tasks:N
+	PromoteInterval time.Duration
+	// CronInterval is how often the cron jobs of owned partitions are checked
+	CronInterval time.Duration
+	// SettleWindow is how long membership must stay quiet before the ring is
+	// updated, bursts of joins and leaves cause one rebalance. Zero applies every event
+	SettleWindow time.Duration
+	// MaxSettleDelay bounds how long a membership change may wait for the burst to settle
+	MaxSettleDelay time.Duration
+	// Weight is the capacity published in the worker registration, the ring
+	// gives the worker a share of partitions proportional to it. Zero uses the CPU count
+	Weight int
+	// Zone is the availability zone (or rack) published in the worker registration
+	Zone string
+	// MigrateInterval is how often tasks of a retired partition layout are moved
+	// to the current one, while a resize is in progress
+	MigrateInterval time.Duration
+	// MigrateBatch bounds how many tasks of each list are moved per partition and interval
+	MigrateBatch int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Partitions:       types.NUM_PARTITIONS,
+		ReliableQueue:    true,
+		Concurrency:      4,
+		Prefetch:         4,
+		DrainTimeout:     30 * time.Second,
+		PartitionLockTTL: 10 * time.Second,
+		PollInterval:     200 * time.Millisecond,
+		Priorities:       queue.DefaultPriorityPolicy(),
+		ReapInterval:     10 * time.Second,
+		PromoteInterval:  time.Second,
+		CronInterval:     time.Second,
+		SettleWindow:     2 * time.Second,
+		MaxSettleDelay:   10 * time.Second,
+		Weight:           0, // the CPU count
+		MigrateInterval:  time.Second,
+		MigrateBatch:     500,
+	}
+}
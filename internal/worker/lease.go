@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	registerBackoff    = 500 * time.Millisecond
+	maxRegisterBackoff = 10 * time.Second
+)
+
+// monitorLease follows the keepalives of the lease. The channel only closes on
+// shutdown or once etcd let the lease expire, after keepalives failed for a whole TTL
+func (w *Worker) monitorLease(leaseID etcd.LeaseID, keepAliveChan <-chan *etcd.LeaseKeepAliveResponse, stop context.CancelFunc) {
+	defer stop()
+
+	for ka := range keepAliveChan {
+		slog.Info("lease renewed succesfully", "New TTL", ka.TTL)
+	}
+
+	if w.closing.Load() || w.runCtx.Err() != nil {
+		slog.Info("keep alive channel closed")
+		return
+	}
+
+	w.leaseLost(leaseID)
+}
+
+// leaseLost fences the worker off: its worker_id: and partition_owner: keys
+// went away with the lease, the other workers already dropped it from the ring
+// and may own its partitions. It stops consuming right away, registers again
+// under a new lease and rejoins the ring once its registration is seen
+func (w *Worker) leaseLost(leaseID etcd.LeaseID) {
+	slog.Error("worker lease lost, fencing off until registered again", "lease", leaseID)
+	w.metrics.IncrLeaseLost()
+
+	w.fenced.Store(true)
+	// the claims go first, the rebalance must not let releaseMoved or the next
+	// run act on partitions we no longer hold. Tasks still in-flight keep their
+	// fencing token, settling them fails once the partition has a new owner and
+	// they are handed back to it
+	w.owner.Drop()
+	w.rebalance()
+
+	backoff := registerBackoff
+	for {
+		err := w.reregister()
+		if err == nil {
+			break
+		}
+		if w.runCtx.Err() != nil {
+			return
+		}
+
+		slog.Warn("error registering worker again", "error", err, "retry_in", backoff)
+
+		select {
+		case <-w.runCtx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRegisterBackoff)
+	}
+
+	w.fenced.Store(false)
+	slog.Info("worker registered again", "worker_id", w.workerID, "lease", w.lease())
+
+	select {
+	case w.updateChan <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Worker) reregister() error {
+	ctx, cancel := context.WithTimeout(w.runCtx, 5*time.Second)
+	defer cancel()
+
+	return w.register(ctx)
+}
@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"dtq/internal/registry"
+	"dtq/internal/ring"
+	"dtq/internal/types"
+	"log/slog"
+	"time"
+)
+
+// memberChange is one worker_id: event, joined is false when the key was deleted
+type memberChange struct {
+	workerID types.WorkerID
+	member   ring.Member
+	joined   bool
+}
+
+// member is what the ring needs from a registration
+func member(r registry.Record) ring.Member {
+	return ring.Member{Weight: r.Weight, TaskTypes: r.TaskTypes, Zone: r.Zone}
+}
+
+// settleMembership coalesces membership events into a single ring update. Each
+// event restarts the cfg.SettleWindow timer and the batch is applied once no
+// event came for that long, or cfg.MaxSettleDelay after its first event so a
+// steady stream of changes cannot hold the ring back forever. A rolling deploy
+// then rebalances a few times instead of once per join and leave.
+//
+// A snapshot is the whole registry, listed again after the watch lost events:
+// it replaces the pending changes and the ring is rebuilt from it right away
+func (w *Worker) settleMembership(changes <-chan memberChange, snapshots <-chan map[types.WorkerID]ring.Member) {
+	pending := map[types.WorkerID]memberChange{}
+	events := 0
+
+	var settle, deadline <-chan time.Time
+
+	for {
+		select {
+		case c, ok := <-changes:
+			if !ok {
+				return
+			}
+
+			// only the last event of a worker counts
+			pending[c.workerID] = c
+			events++
+
+			if w.cfg.SettleWindow > 0 {
+				settle = time.After(w.cfg.SettleWindow)
+				if deadline == nil {
+					deadline = time.After(max(w.cfg.MaxSettleDelay, w.cfg.SettleWindow))
+				}
+				continue
+			}
+		case members := <-snapshots:
+			w.rebuildMembership(members, events)
+
+			pending = map[types.WorkerID]memberChange{}
+			events = 0
+			settle, deadline = nil, nil
+			continue
+		case <-settle:
+		case <-deadline:
+		}
+
+		w.applyMembership(pending, events)
+
+		pending = map[types.WorkerID]memberChange{}
+		events = 0
+		settle, deadline = nil, nil
+	}
+}
+
+// applyMembership updates the ring with a batch of changes and rebalances once
+func (w *Worker) applyMembership(pending map[types.WorkerID]memberChange, events int) {
+	left := false
+
+	for workerID, c := range pending {
+		if c.joined {
+			slog.Info("🟢 Worker joined", "id", workerID, "weight", c.member.Weight, "zone", c.member.Zone, "task_types", c.member.TaskTypes)
+			w.chr.AddMember(workerID, c.member)
+		} else {
+			slog.Info("🔴 Worker left", "id", workerID)
+			w.chr.RemoveNode(workerID)
+			left = true
+		}
+	}
+
+	if events > 1 {
+		w.metrics.IncrSuppressedRebalances(uint64(events - 1))
+	}
+
+	slog.Warn("worker agora é dono das partitions", "partitions", w.chr.FetchPartitionsForNode(w.workerID), "events", events)
+
+	w.membershipChanged(left)
+}
+
+// rebuildMembership replaces the ring members with a registry snapshot, the
+// pending events it supersedes are counted as suppressed
+func (w *Worker) rebuildMembership(members map[types.WorkerID]ring.Member, events int) {
+	w.chr.Rebuild(members)
+
+	if events > 0 {
+		w.metrics.IncrSuppressedRebalances(uint64(events))
+	}
+
+	slog.Warn("ring rebuilt from the registry", "workers", len(members), "partitions", w.chr.FetchPartitionsForNode(w.workerID))
+
+	// a worker may have left while events were lost, reaping is cheap
+	w.membershipChanged(true)
+}
+
+// membershipChanged triggers a rebalance, and a reap when a worker left
+func (w *Worker) membershipChanged(left bool) {
+	// the channel holds one pending rebalance, a second one would be the same
+	select {
+	case w.updateChan <- struct{}{}:
+	default:
+	}
+
+	if left {
+		select {
+		case w.reapChan <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package worker
+
+import (
+	"context"
+	"dtq/internal/cluster"
+	"dtq/internal/dlq"
+	"dtq/internal/partition"
+	"dtq/internal/queue"
+	"dtq/internal/ring"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"dtq/internal/watch"
+	"log/slog"
+	"slices"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+// applyMetadata makes the ring assign every layout of the cluster, the retired
+// one included while it is migrated, and moves cron jobs to the current layout
+func (w *Worker) applyMetadata(meta cluster.Metadata) {
+	layouts := meta.Layouts()
+
+	ranges := make([]ring.Range, 0, len(layouts)+len(meta.Routes))
+	for _, layout := range layouts {
+		ranges = append(ranges, ring.Range{First: layout.First, Count: layout.Partitions})
+	}
+	// a routed task type is only assigned to the workers supporting it
+	for taskType, route := range meta.Routes {
+		ranges = append(ranges, ring.Range{First: route.First, Count: route.Partitions, TaskType: taskType})
+	}
+
+	w.chr.SetRanges(ranges)
+	w.meta.Store(&meta)
+
+	if w.cron != nil {
+		w.cron.SetPartitioner(meta.Partitioner())
+	}
+}
+
+// watchCluster follows the cluster metadata: a resize or the end of a
+// migration changes the partitions of the ring, so it causes a rebalance
+func (w *Worker) watchCluster() {
+	watcher := watch.NewWatcher(w.conn.GetEtcd(), "cluster", cluster.MetadataKey, watch.Handler{
+		Reset: func(kvs []*mvccpb.KeyValue) {
+			for _, kv := range kvs {
+				w.metadataChanged(kv)
+			}
+		},
+		Apply: func(event *etcd.Event) {
+			if event.Type == etcd.EventTypePut {
+				w.metadataChanged(event.Kv)
+			}
+		},
+	}, w.metrics)
+
+	watcher.Run(w.runCtx, w.meta.Load().Revision+1)
+}
+
+func (w *Worker) metadataChanged(kv *mvccpb.KeyValue) {
+	meta, err := cluster.Decode(kv.Value)
+	if err != nil {
+		slog.Error("ignoring cluster metadata update", "error", err)
+		return
+	}
+	meta.Revision = kv.ModRevision
+
+	current := w.meta.Load()
+	if current.Epoch == meta.Epoch && (current.Migrating == nil) == (meta.Migrating == nil) && len(current.Routes) == len(meta.Routes) {
+		return
+	}
+
+	w.applyMetadata(meta)
+	if len(meta.Routes) != len(current.Routes) {
+		slog.Info("task type routes changed", "routes", len(meta.Routes))
+	} else if meta.Migrating != nil {
+		slog.Info("partition layout resized, migrating tasks", "epoch", meta.Epoch, "partitions", meta.Partitions, "from", meta.Migrating.Partitions)
+	} else {
+		slog.Info("partition migration finished", "epoch", meta.Epoch, "partitions", meta.Partitions)
+	}
+
+	select {
+	case w.updateChan <- struct{}{}:
+	default:
+	}
+}
+
+// migrateLoop moves the tasks of the retired partitions this worker holds to
+// the current layout, and retires the layout once nothing is left on it
+func (w *Worker) migrateLoop() {
+	ticker := time.NewTicker(w.cfg.MigrateInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		meta := w.meta.Load()
+		if meta.Migrating == nil {
+			continue
+		}
+
+		if err := w.migrate(meta); err != nil {
+			if w.runCtx.Err() != nil {
+				return
+			}
+			slog.Error("error migrating partitions", "epoch", meta.Epoch, "error", err)
+		}
+	}
+}
+
+func (w *Worker) migrate(meta *cluster.Metadata) error {
+	route := router(meta.Partitioner())
+	relocate := func(raw []byte) (types.PartitionID, []byte) {
+		return dlq.Relocate(raw, route)
+	}
+
+	moved := 0
+	for _, partitionID := range w.owner.Held() {
+		if !meta.Migrating.Contains(partitionID) {
+			continue
+		}
+
+		n, err := w.migrator.Migrate(w.runCtx, partitionID, route, w.cfg.MigrateBatch)
+		moved += n
+		if err != nil {
+			return err
+		}
+
+		n, err = w.migrator.MigrateDeadLetters(w.runCtx, partitionID, relocate, w.cfg.MigrateBatch)
+		moved += n
+		if err != nil {
+			return err
+		}
+	}
+
+	if moved > 0 {
+		w.metrics.IncrMigrated(uint64(moved))
+		slog.Info("migrated tasks to the new partition layout", "tasks", moved, "epoch", meta.Epoch)
+		return nil
+	}
+
+	// a single worker, the owner of the first retired partition, checks the
+	// whole layout so the metadata is not written by everyone at once
+	if _, ok := w.owner.Token(meta.Migrating.First); !ok {
+		return nil
+	}
+
+	drained, err := w.migrator.Drained(w.runCtx, meta.Migrating.IDs())
+	if err != nil || !drained {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(w.runCtx, 5*time.Second)
+	defer cancel()
+
+	if err := cluster.FinishMigration(ctx, w.conn.GetEtcd(), meta.Epoch); err != nil {
+		return err
+	}
+
+	slog.Info("retired partition layout drained", "epoch", meta.Migrating.Epoch, "partitions", meta.Migrating.Partitions)
+	return nil
+}
+
+// forward moves a task of a routed type this worker has no handler for to the
+// partitions of its route, instead of failing it. Tasks enqueued before the
+// route was added, or by a producer that did not see it yet, sit on the
+// general partitions every worker consumes
+func (w *Worker) forward(d *queue.Delivery, t *task.Task) bool {
+	meta := w.meta.Load()
+	if meta == nil {
+		return false
+	}
+
+	route, ok := meta.Routes[t.Type]
+	if !ok || route.Contains(d.Partition) || slices.Contains(w.handlers.TaskTypes(), t.Type) {
+		return false
+	}
+
+	target := partition.For(meta.Partitioner(), t.Type, t.PartitionKey())
+	if err := w.queue.Forward(context.Background(), d, target); err != nil {
+		w.settleFailed(d, "error forwarding task to its route", err, "task", t.ID)
+		return true
+	}
+
+	slog.Info("task forwarded to the partitions of its type", "task", t.ID, "type", t.Type, "partition", d.Source, "target", target)
+	return true
+}
+
+// router sends a task to the partition its producer would pick with the
+// current layout. Tasks that do not decode are routed by their bytes
+func router(p partition.IPartitioner) queue.Router {
+	return func(raw []byte) types.PartitionID {
+		t, err := task.Decode(raw)
+		if err != nil {
+			return p.Partition(string(raw))
+		}
+		return partition.For(p, t.Type, t.PartitionKey())
+	}
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"dtq/internal/cluster"
+	"dtq/internal/handler"
+	"dtq/internal/metrics"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"testing"
+)
+
+func TestForwardRoutedTaskTypes(t *testing.T) {
+	meta := cluster.Metadata{
+		Layout: cluster.Layout{Epoch: 1, First: 0, Partitions: 16},
+		Routes: map[string]cluster.Layout{"resize-image": {First: 16, Partitions: 4}},
+	}
+
+	handlers := handler.NewHandlerRegistry()
+	handlers.Register("send-email", func(ctx context.Context, t task.Task) error { return nil })
+
+	tests := []struct {
+		name      string
+		partition types.PartitionID
+		taskType  string
+		handlers  handler.IHandlerRegistry
+		forwarded bool
+	}{
+		{"routed type without handler", 3, "resize-image", handlers, true},
+		{"routed type already on its route", 17, "resize-image", handlers, false},
+		{"type that is not routed", 3, "send-email", handlers, false},
+		{"unknown type that is not routed", 3, "transcode", handlers, false},
+		{"routed type with a handler", 3, "resize-image", withHandler(t, "resize-image"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &settleQueue{requeued: map[string][]byte{}, forwarded: map[string]types.PartitionID{}}
+			w := &Worker{queue: q, metrics: &metrics.Metrics{}, handlers: tt.handlers}
+			w.meta.Store(&meta)
+
+			d := delivery(t, tt.partition, tt.taskType)
+			decoded, err := task.Decode([]byte(d.Raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := w.forward(d, decoded); got != tt.forwarded {
+				t.Fatalf("forward = %v, want %v", got, tt.forwarded)
+			}
+
+			target, ok := q.forwarded[d.Raw]
+			if ok != tt.forwarded {
+				t.Fatalf("forwarded to the queue = %v, want %v", ok, tt.forwarded)
+			}
+			if ok && !meta.Routes[tt.taskType].Contains(target) {
+				t.Fatalf("forwarded to partition %d, outside the route", target)
+			}
+		})
+	}
+}
+
+func withHandler(t *testing.T, taskType string) handler.IHandlerRegistry {
+	t.Helper()
+
+	handlers := handler.NewHandlerRegistry()
+	handlers.Register(taskType, func(ctx context.Context, t task.Task) error { return nil })
+	return handlers
+}
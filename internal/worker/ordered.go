@@ -0,0 +1,212 @@
+package worker
+
+import (
+	"context"
+	"dtq/internal/queue"
+	"dtq/internal/registry"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"log/slog"
+	"sync"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+// runOrdered gives each owned partition its own sequential consumer, so tasks of
+// a partition are handled one at a time in list order. cfg.Concurrency bounds
+// how many partitions run a handler at the same time.
+//
+// A consumer only starts once it holds the partition lock, which the previous
+// owner keeps until its in-flight task on that partition is done
+func (w *Worker) runOrdered(ctx context.Context, partitions []types.PartitionID) {
+	handlerCtx, cancelHandlers := w.drainContext(ctx)
+	defer cancelHandlers()
+
+	slots := make(chan struct{}, w.cfg.Concurrency)
+
+	var wg sync.WaitGroup
+	for _, partitionID := range partitions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consumePartition(ctx, handlerCtx, partitionID, slots)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (w *Worker) consumePartition(ctx, handlerCtx context.Context, partitionID types.PartitionID, slots chan struct{}) {
+	if !w.lockPartition(ctx, partitionID) {
+		return
+	}
+
+	partitionCtx, cancel := context.WithCancel(ctx)
+	go w.keepPartitionLock(partitionCtx, partitionID, cancel)
+
+	defer func() {
+		cancel()
+		if err := w.locker.Release(context.Background(), partitionID); err != nil {
+			slog.Warn("error releasing partition lock", "partition", partitionID, "error", err)
+		}
+	}()
+
+	partitions := []types.PartitionID{partitionID}
+
+	for {
+		d, err := w.queue.Fetch(partitionCtx, partitions)
+		if err != nil {
+			if partitionCtx.Err() != nil {
+				return
+			}
+			slog.Error("error fetching task", "partition", partitionID, "error", err)
+
+			select {
+			case <-partitionCtx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		w.stamp(d)
+
+		if !w.processOrdered(partitionCtx, handlerCtx, d, slots) {
+			return
+		}
+	}
+}
+
+// lockPartition waits for the partition lock. If the previous holder died with
+// a task in-flight, that task is put back at the head first so order is kept
+func (w *Worker) lockPartition(ctx context.Context, partitionID types.PartitionID) bool {
+	for {
+		acquired, previous, err := w.locker.Acquire(ctx, partitionID)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("error acquiring partition lock", "partition", partitionID, "error", err)
+		}
+
+		if acquired {
+			if previous != "" && previous != w.workerID && !w.isAlive(previous) {
+				recovered, err := w.queue.RecoverWorker(ctx, previous, partitionID)
+				if err != nil {
+					slog.Error("error recovering previous holder tasks", "partition", partitionID, "holder", previous, "error", err)
+				}
+				if recovered > 0 {
+					w.metrics.IncrRecovered(uint64(recovered))
+				}
+			}
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(w.cfg.PollInterval):
+		}
+	}
+}
+
+// keepPartitionLock refreshes the lock and stops the consumer if it was lost
+func (w *Worker) keepPartitionLock(ctx context.Context, partitionID types.PartitionID, stop context.CancelFunc) {
+	ticker := time.NewTicker(w.cfg.PartitionLockTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		held, err := w.locker.Refresh(ctx, partitionID)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("error refreshing partition lock", "partition", partitionID, "error", err)
+			}
+			continue
+		}
+
+		if !held {
+			slog.Warn("partition lock lost, stopping consumer", "partition", partitionID)
+			stop()
+			return
+		}
+	}
+}
+
+// processOrdered retries failed tasks in place instead of through the retry set,
+// the next task of the partition must not run before this one is settled.
+//
+// A slot is only held while the handler runs, a partition backing off does not
+// keep the other partitions waiting. If the partition is handed over before the
+// task is settled, the task goes back to the head of its list with its attempt
+// count. It returns false in that case, the consumer must stop
+func (w *Worker) processOrdered(partitionCtx, handlerCtx context.Context, d *queue.Delivery, slots chan struct{}) bool {
+	t, ok := w.decode(d)
+	if !ok || w.forward(d, t) {
+		return true
+	}
+
+	for failed := false; ; failed = true {
+		select {
+		case slots <- struct{}{}:
+		case <-partitionCtx.Done():
+			w.handBack(d, t, failed)
+			return false
+		}
+
+		err := w.handle(handlerCtx, d, t)
+		<-slots
+
+		if err == nil {
+			w.succeeded(d, t)
+			return true
+		}
+
+		delay, ok := w.failed(d, t, err)
+		if !ok {
+			return true
+		}
+
+		slog.Warn("task failed, retrying in place", "worker", w.workerID, "task", t.ID, "type", t.Type, "attempt", t.Attempt, "delay", delay, "partition", d.Source, "error", err)
+		w.metrics.IncrRetry(t.Type)
+
+		select {
+		case <-time.After(delay):
+		case <-partitionCtx.Done():
+			w.handBack(d, t, true)
+			return false
+		}
+	}
+}
+
+// handBack returns a task the consumer stopped waiting on to the head of its
+// list, updated with its attempt count once it failed
+func (w *Worker) handBack(d *queue.Delivery, t *task.Task, failed bool) {
+	if !failed {
+		w.release(d)
+		return
+	}
+
+	raw, ok := w.encode(d, t)
+	if !ok {
+		return
+	}
+	if err := w.queue.Requeue(context.Background(), d, raw); err != nil {
+		w.settleFailed(d, "error returning task", err, "task", t.ID)
+	}
+}
+
+// isAlive tells whether the worker is still registered. When etcd cannot be
+// reached the worker is assumed alive, recovering its tasks would be unsafe
+func (w *Worker) isAlive(workerID types.WorkerID) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := w.conn.GetEtcd().Get(ctx, registry.Key(workerID), etcd.WithCountOnly())
+	if err != nil {
+		return true
+	}
+	return resp.Count > 0
+}
@@ -0,0 +1,196 @@
+package worker
+
+import (
+	"context"
+	"dtq/internal/handler"
+	"dtq/internal/metrics"
+	"dtq/internal/queue"
+	"dtq/internal/retry"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// settleQueue records how deliveries were settled, the other methods are not
+// used by processOrdered
+type settleQueue struct {
+	queue.IQueue
+
+	mu        sync.Mutex
+	acked     []string
+	requeued  map[string][]byte
+	forwarded map[string]types.PartitionID
+}
+
+func (q *settleQueue) Forward(ctx context.Context, d *queue.Delivery, target types.PartitionID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.forwarded[d.Raw] = target
+	return nil
+}
+
+func (q *settleQueue) Ack(ctx context.Context, d *queue.Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.acked = append(q.acked, d.Raw)
+	return nil
+}
+
+func (q *settleQueue) Requeue(ctx context.Context, d *queue.Delivery, raw []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.requeued[d.Raw] = raw
+	return nil
+}
+
+func (q *settleQueue) DeadLetter(ctx context.Context, d *queue.Delivery, entry []byte) error {
+	return errors.New("unexpected dead letter")
+}
+
+func delivery(t *testing.T, partition types.PartitionID, taskType string) *queue.Delivery {
+	t.Helper()
+
+	raw, err := task.JSONCodec{}.Encode(task.New(taskType, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &queue.Delivery{Partition: partition, Source: queue.TaskKey(partition), Raw: string(raw)}
+}
+
+func TestOrderedBackoffFreesTheSlot(t *testing.T) {
+	failing := make(chan struct{}, 1)
+	handled := make(chan struct{}, 1)
+
+	handlers := handler.NewHandlerRegistry()
+	handlers.Register("failing", func(ctx context.Context, t task.Task) error {
+		select {
+		case failing <- struct{}{}:
+		default:
+		}
+		return errors.New("always fails")
+	}, handler.WithRetryPolicy(retry.Policy{
+		MaxAttempts: 100,
+		Backoff:     retry.LinearBackoff{Base: time.Hour},
+	}))
+	handlers.Register("working", func(ctx context.Context, t task.Task) error {
+		handled <- struct{}{}
+		return nil
+	})
+
+	q := &settleQueue{requeued: map[string][]byte{}}
+	w := &Worker{
+		queue:    q,
+		metrics:  &metrics.Metrics{},
+		handlers: handlers,
+		cfg:      DefaultConfig(),
+	}
+
+	// a single slot, shared by both partitions
+	slots := make(chan struct{}, 1)
+
+	failingCtx, stopFailing := context.WithCancel(context.Background())
+	defer stopFailing()
+
+	stuck := delivery(t, 1, "failing")
+	stuckDone := make(chan bool, 1)
+	go func() {
+		stuckDone <- w.processOrdered(failingCtx, context.Background(), stuck, slots)
+	}()
+
+	select {
+	case <-failing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the failing task never ran")
+	}
+
+	// partition 1 is backing off for an hour, partition 2 must still run
+	other := delivery(t, 2, "working")
+	otherDone := make(chan bool, 1)
+	go func() {
+		otherDone <- w.processOrdered(context.Background(), context.Background(), other, slots)
+	}()
+
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a partition backing off kept the only slot, the other partition made no progress")
+	}
+	if ok := <-otherDone; !ok {
+		t.Fatal("the working partition was told to stop")
+	}
+
+	q.mu.Lock()
+	if len(q.acked) != 1 || q.acked[0] != other.Raw {
+		t.Fatalf("acked %v, want only the working task", q.acked)
+	}
+	q.mu.Unlock()
+
+	// handing the partition over during the backoff returns the task with its attempt
+	stopFailing()
+	select {
+	case ok := <-stuckDone:
+		if ok {
+			t.Fatal("the consumer of a handed over partition was told to go on")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the backoff did not stop when the partition was handed over")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	raw, ok := q.requeued[stuck.Raw]
+	if !ok {
+		t.Fatal("the failing task was not returned to its list")
+	}
+	returned, err := task.Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if returned.Attempt != 1 {
+		t.Fatalf("returned task attempt = %d, want 1", returned.Attempt)
+	}
+}
+
+func TestOrderedWaitingForASlotHandsTheTaskBack(t *testing.T) {
+	q := &settleQueue{requeued: map[string][]byte{}}
+	w := &Worker{
+		queue:    q,
+		metrics:  &metrics.Metrics{},
+		handlers: handler.NewHandlerRegistry(),
+		cfg:      DefaultConfig(),
+	}
+
+	// the only slot is taken by another partition
+	slots := make(chan struct{}, 1)
+	slots <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := delivery(t, 3, "any")
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- w.processOrdered(ctx, context.Background(), d, slots)
+	}()
+
+	cancel()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("the consumer of a handed over partition was told to go on")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting for a slot did not stop when the partition was handed over")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// never handled, it goes back untouched
+	if raw := q.requeued[d.Raw]; string(raw) != d.Raw {
+		t.Fatalf("returned %q, want the delivery unchanged", raw)
+	}
+}
@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"context"
+	"dtq/internal/handler"
+	"dtq/internal/queue"
+	"dtq/internal/task"
+	"dtq/internal/types"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// runPool fetches from the partitions into a prefetch buffer consumed by
+// cfg.Concurrency handlers, until ctx is canceled. The buffer is the
+// backpressure: when every handler is busy and the buffer is full the fetcher
+// blocks instead of pulling more tasks out of redis.
+//
+// On cancel, fetching stops, tasks still waiting in the buffer are returned to
+// their partition and in-flight tasks get cfg.DrainTimeout to finish
+func (w *Worker) runPool(ctx context.Context, partitions []types.PartitionID) {
+	deliveries := make(chan *queue.Delivery, w.cfg.Prefetch)
+	handlerCtx, cancelHandlers := w.drainContext(ctx)
+	defer cancelHandlers()
+
+	var wg sync.WaitGroup
+	for range w.cfg.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-deliveries:
+					// select picks at random, do not start new work after a cancel
+					if ctx.Err() != nil {
+						w.release(d)
+						return
+					}
+					w.process(handlerCtx, d)
+				}
+			}
+		}()
+	}
+
+	w.fetch(ctx, partitions, deliveries)
+
+	wg.Wait()
+
+	for {
+		select {
+		case d := <-deliveries:
+			w.release(d)
+		default:
+			return
+		}
+	}
+}
+
+// fetch pushes deliveries into out until ctx is canceled
+func (w *Worker) fetch(ctx context.Context, partitions []types.PartitionID, out chan<- *queue.Delivery) {
+	for {
+		d, err := w.queue.Fetch(ctx, partitions)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("error fetching task", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		w.stamp(d)
+
+		select {
+		case out <- d:
+		case <-ctx.Done():
+			w.release(d)
+			return
+		}
+	}
+}
+
+// drainContext is the context given to handlers: it outlives ctx by
+// cfg.DrainTimeout so in-flight tasks can finish after a rebalance, and is
+// canceled right away on shutdown
+func (w *Worker) drainContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	handlerCtx, cancel := context.WithCancel(w.runCtx)
+
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.AfterFunc(w.cfg.DrainTimeout, cancel)
+		context.AfterFunc(handlerCtx, func() { timer.Stop() })
+	})
+
+	return handlerCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// handle runs the handler bounded by cfg.HandlerTimeout, so a stuck handler
+// fails (and is retried) instead of holding a slot forever. The handler gets
+// the delivery fencing token through its ctx
+func (w *Worker) handle(ctx context.Context, d *queue.Delivery, t *task.Task) error {
+	ctx = handler.WithFencingToken(ctx, d.Token)
+
+	if w.cfg.HandlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.cfg.HandlerTimeout)
+		defer cancel()
+	}
+
+	w.metrics.AddInFlight(1)
+	defer w.metrics.AddInFlight(-1)
+
+	err := w.handlers.Handle(ctx, *t)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("handler timed out", "task", t.ID, "type", t.Type, "timeout", w.cfg.HandlerTimeout)
+	}
+
+	return err
+}
+
+// release returns a delivery that was fetched but never handled to the head of its list
+func (w *Worker) release(d *queue.Delivery) {
+	if err := w.queue.Requeue(context.Background(), d, []byte(d.Raw)); err != nil {
+		w.settleFailed(d, "error returning prefetched task", err)
+	}
+}
@@ -2,33 +2,74 @@ package worker
 
 import (
 	"context"
+	"dtq/internal/cluster"
 	"dtq/internal/conn"
+	"dtq/internal/cron"
+	"dtq/internal/dlq"
+	"dtq/internal/handler"
 	"dtq/internal/metrics"
+	"dtq/internal/ownership"
+	"dtq/internal/queue"
+	"dtq/internal/registry"
 	"dtq/internal/ring"
+	"dtq/internal/task"
 	"dtq/internal/types"
+	"dtq/internal/watch"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
-	"strings"
+	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	etcd "go.etcd.io/etcd/client/v3"
 )
 
 type Worker struct {
 	workerID    types.WorkerID
-	leaseID     int64
+	leaseID     atomic.Int64
+	weight      int
+	taskTypes   []string
+	hostname    string
+	zone        string
+	startedAt   time.Time
 	metricsPort string
 	updateChan  chan struct{}
-
-	conn    conn.IConn
-	chr     ring.IHashRing
-	metrics metrics.IMetrics
+	reapChan    chan struct{}
+	cfg         Config
+
+	// closing stops RunTask from being called again, done is closed once it returned
+	closing atomic.Bool
+	// fenced is set while the worker has no lease: it must not consume anything
+	fenced atomic.Bool
+	done   chan struct{}
+
+	conn      conn.IConn
+	chr       ring.ILayeredRing
+	metrics   metrics.IMetrics
+	queue     queue.IQueue
+	scheduler queue.IScheduler
+	locker    *queue.PartitionLocker
+	owner     ownership.IManager
+	migrator  *queue.Migrator
+	cron      *cron.Runner
+	handlers  handler.IHandlerRegistry
+
+	// meta is the cluster metadata the ring was last built from
+	meta atomic.Pointer[cluster.Metadata]
 
 	ctx    context.Context
 	cancel context.CancelFunc
+	// rebalancedAt is when the current partitions were decided, handoff latency starts there
+	rebalancedAt time.Time
+	// runCtx lives until shutdown, handlers get it so a rebalance does not abort them
+	runCtx context.Context
+	stop   context.CancelFunc
 	mu     sync.Mutex
 }
 
@@ -36,47 +77,111 @@ type IWorker interface {
 	RunTask()
 	CreateWorker()
 	CreateLease()
-	GetWorkers() []*Worker
+	GetWorkers() ([]*Worker, int64)
 	GetWorkerID() types.WorkerID
 	GetMetricsPort() string
-	WatchWorkers()
+	WatchWorkers(fromRevision int64)
 	Shutdown()
 }
 
 func NewWorker(
 	conn conn.IConn,
-	chr ring.IHashRing,
+	chr ring.ILayeredRing,
 	metrics metrics.IMetrics,
+	handlers handler.IHandlerRegistry,
+	cfg Config,
 ) IWorker {
+	cfg.Concurrency = max(cfg.Concurrency, 1)
+	cfg.Prefetch = max(cfg.Prefetch, 0)
+	if cfg.Weight == 0 {
+		cfg.Weight = runtime.NumCPU()
+	}
+
+	defaults := DefaultConfig()
+	// the fetch, lock and claim retries wait PollInterval, without it they spin
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	// the loops tick at these intervals, time.NewTicker panics on zero
+	if cfg.ReapInterval <= 0 {
+		cfg.ReapInterval = defaults.ReapInterval
+	}
+	if cfg.PromoteInterval <= 0 {
+		cfg.PromoteInterval = defaults.PromoteInterval
+	}
+	if cfg.CronInterval <= 0 {
+		cfg.CronInterval = defaults.CronInterval
+	}
+	if cfg.MigrateInterval <= 0 {
+		cfg.MigrateInterval = defaults.MigrateInterval
+	}
+	if cfg.MigrateBatch <= 0 {
+		cfg.MigrateBatch = defaults.MigrateBatch
+	}
+	// the lock is refreshed every third of its ttl, and redis expires by the millisecond
+	if cfg.PartitionLockTTL < time.Millisecond {
+		cfg.PartitionLockTTL = defaults.PartitionLockTTL
+	}
+
 	// context with cancel because needs to be canceled when we need to rebalance
 	ctx, cancel := context.WithCancel(context.Background())
+	runCtx, stop := context.WithCancel(context.Background())
 
 	w := Worker{
 		ctx:        ctx,
 		cancel:     cancel,
+		runCtx:     runCtx,
+		stop:       stop,
 		conn:       conn,
 		chr:        chr,
 		metrics:    metrics,
+		handlers:   handlers,
 		updateChan: make(chan struct{}, 1),
+		reapChan:   make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		cfg:        cfg,
+		weight:     registry.ClampWeight(cfg.Weight),
+
+		rebalancedAt: time.Now(),
 	}
 
 	w.CreateWorker()
 	metrics.SetWorkerID(w.workerID)
 
+	w.owner = ownership.NewManager(conn, w.workerID, w.lease)
+
+	if cfg.ReliableQueue {
+		w.queue = queue.NewReliableQueue(conn, w.workerID, cfg.PollInterval, cfg.Priorities)
+		go w.reapLoop()
+	} else {
+		w.queue = queue.NewBlockingQueue(conn, cfg.Priorities)
+	}
+
+	w.locker = queue.NewPartitionLocker(conn, w.workerID, cfg.PartitionLockTTL)
+	w.scheduler = queue.NewScheduler(conn)
+	go w.promoteLoop()
+
+	w.cron = cron.NewRunner(conn, w.meta.Load().Partitioner(), w.workerID)
+	go w.cronLoop()
+
+	w.migrator = queue.NewMigrator(conn, w.workerID)
+	go w.migrateLoop()
+	go w.watchCluster()
+
 	slog.Info("Worker up and running 👽", "id", w.workerID)
 
 	// goroutine to detect rebalancing (updated workers on etcd)
 	go func() {
 		for range w.updateChan {
-			slog.Info("Rebalancing detected, canceling current BLPOP")
+			slog.Info("Rebalancing detected, canceling current fetch")
 			w.UpdateMetrics()
-			w.cancel()
+			w.rebalance()
 		}
 	}()
 
 	go func() {
-		for {
-			// time.Sleep(time.Second * 1)
+		defer close(w.done)
+		for !w.closing.Load() {
 			w.RunTask()
 		}
 	}()
@@ -90,9 +195,32 @@ func (w *Worker) UpdateMetrics() {
 	w.mu.Unlock()
 
 	w.metrics.SetPartitions(uint64(partitions))
+	w.metrics.SetStandbyPartitions(uint64(len(w.standbyPartitions())))
 	w.metrics.IncrRebalancing()
 }
 
+// standbyPartitions lists the partitions that fail over to this worker if the
+// zone of their owner is lost, always empty unless the ring is zone aware
+func (w *Worker) standbyPartitions() []types.PartitionID {
+	meta := w.meta.Load()
+
+	layouts := meta.Layouts()
+	for _, route := range meta.Routes {
+		layouts = append(layouts, route)
+	}
+
+	standby := make([]types.PartitionID, 0)
+	for _, layout := range layouts {
+		for _, partitionID := range layout.IDs() {
+			if w.chr.GetStandbyForPartition(partitionID) == w.workerID {
+				standby = append(standby, partitionID)
+			}
+		}
+	}
+
+	return standby
+}
+
 func (w *Worker) CreateWorker() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -104,129 +232,492 @@ func (w *Worker) CreateWorker() {
 
 	timestamp := time.Now().UnixNano()
 	w.workerID = types.WorkerID(fmt.Sprintf("worker-%s-%d-%d", host, timestamp, os.Getpid()))
+	w.hostname = host
+	w.startedAt = time.Now().UTC()
+	w.metricsPort = fmt.Sprintf("%d", 11111+(os.Getpid()%1000))
 
 	slog.Info("connecting to etcd...")
 
+	// a worker with another partition count would disagree with the cluster
+	// on where every task goes, it must not join
+	meta, err := cluster.Join(context.Background(), w.conn.GetEtcd(), w.cfg.Partitions)
+	if err != nil {
+		log.Fatalf("refusing to join the cluster: %v", err)
+	}
+
+	slog.Info("cluster metadata validated", "partitions", meta.Partitions, "epoch", meta.Epoch)
+
+	w.applyMetadata(meta)
+
 	w.CreateLease()
-	w.CreateEtcdPrometheusDiscovery()
 
 	slog.Info("lease created")
 
-	w.chr.AddNodes(w.workerID)
+	// bootstrap the ring with every registered worker (ourselves included) and
+	// watch from right after the snapshot, so no event is missed or applied twice
+	workers, revision := w.GetWorkers()
+	for _, worker := range workers {
+		w.chr.AddMember(worker.workerID, ring.Member{Weight: worker.weight, TaskTypes: worker.taskTypes, Zone: worker.zone})
+	}
 
-	slog.Info("worker added to ring", "worker_id", w.workerID)
+	slog.Info("ring bootstrapped from etcd", "worker_id", w.workerID, "workers", len(workers), "revision", revision)
 
 	myPartitions := w.chr.FetchPartitionsForNode(w.workerID)
 
 	w.metrics.SetPartitions(uint64(len(myPartitions)))
+	w.metrics.SetStandbyPartitions(uint64(len(w.standbyPartitions())))
 
-	// workers := w.GetWorkers()
-
-	w.WatchWorkers()
+	w.WatchWorkers(revision + 1)
 }
 
+// RunTask consumes the owned partitions until the next rebalance (or shutdown),
+// then drains the in-flight work so the next call starts from the new partitions.
+//
+// The ring only says which partitions should be ours, a partition changes hands
+// in two phases:
+//  1. the losing owner stops fetching, finishes or returns its in-flight tasks
+//     and only then publishes the partition as released (releaseMoved)
+//  2. the gaining owner claims partition_owner:N, which fails until that
+//     release, so partitions still held are awaited in the background and
+//     picked up with a new run
 func (w *Worker) RunTask() {
-	if len(w.chr.GetNodePartitions(w.workerID)) == 0 {
-		time.Sleep(time.Second)
+	w.mu.Lock()
+	ctx, cancel := w.ctx, w.cancel
+	w.mu.Unlock()
+
+	partitions := w.chr.GetNodePartitions(w.workerID)
+	if w.fenced.Load() {
+		// the lease was lost, the ring we see may still give us partitions
+		// that other workers already took over
+		partitions = nil
+	}
+
+	// the previous run is drained, hand over what the ring moved away
+	w.releaseMoved(partitions)
+
+	claimed := w.claim(ctx, partitions)
+	if len(claimed) < len(partitions) {
+		go w.awaitClaims(ctx, cancel, partitions)
+	}
+
+	if len(claimed) == 0 {
+		// nothing to consume until a rebalance or awaitClaims takes a partition
+		<-ctx.Done()
+		w.resetContext()
 		return
 	}
+	partitions = claimed
 
-	partitions := make([]string, len(w.chr.GetNodePartitions(w.workerID)))
-	for i, partitionID := range w.chr.GetNodePartitions(w.workerID) {
-		partitions[i] = fmt.Sprintf("tasks:%d", partitionID)
+	if w.cfg.Ordered {
+		w.runOrdered(ctx, partitions)
+	} else {
+		w.runPool(ctx, partitions)
 	}
 
-	res, err := w.conn.GetRedis().BLPop(w.ctx, 0, partitions...).Result()
-	if err != nil {
-		if err == context.Canceled {
-			slog.Info("current blpop canceled. Workers udpated. Recreating context for new partitions...")
-			// context canceled, on the next loop on our main func it will be recalculated its new partitions and call runTask again
-			w.mu.Lock()
-			w.ctx, w.cancel = context.WithCancel(context.Background())
-			w.mu.Unlock()
+	slog.Info("current fetch canceled. Workers udpated. Recreating context for new partitions...")
+	// context canceled, on the next loop on our main func it will be recalculated its new partitions and call runTask again
+	w.resetContext()
+}
+
+func (w *Worker) resetContext() {
+	w.mu.Lock()
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.mu.Unlock()
+}
+
+// claim takes the owner keys of the partitions and returns the ones we hold
+func (w *Worker) claim(ctx context.Context, partitions []types.PartitionID) []types.PartitionID {
+	claims, err := w.owner.Claim(ctx, partitions)
+	if err != nil && ctx.Err() == nil {
+		slog.Error("error claiming partitions", "error", err)
+	}
+
+	w.mu.Lock()
+	since := time.Since(w.rebalancedAt)
+	w.mu.Unlock()
+
+	claimed := make([]types.PartitionID, 0, len(claims))
+	for _, c := range claims {
+		claimed = append(claimed, c.Partition)
+		if !c.New {
+			continue
+		}
+
+		w.metrics.ObserveHandoff(metrics.HandoffAcquire, since)
+		if c.Released != nil {
+			slog.Info("partition handed over", "partition", c.Partition, "from", c.Released.WorkerID, "token", c.Token, "latency", since)
+		} else {
+			slog.Info("partition claimed", "partition", c.Partition, "token", c.Token, "latency", since)
+		}
+	}
+
+	return claimed
+}
+
+// claimRetryInterval is how often awaitClaims claims again without waiting for
+// a release. A claim that failed on an etcd or redis error leaves no owner key
+// to delete, or one of ours, and the watch alone would never wake up for it
+const claimRetryInterval = time.Second
+
+// awaitClaims waits for the partitions another worker still holds to be
+// released, and restarts the run (cancel) once one of them is ours
+func (w *Worker) awaitClaims(ctx context.Context, cancel context.CancelFunc, partitions []types.PartitionID) {
+	for {
+		awaitCtx, stop := context.WithTimeout(ctx, claimRetryInterval)
+		err := w.owner.Await(awaitCtx, w.pending(partitions))
+		timedOut := awaitCtx.Err() != nil
+		stop()
+
+		if ctx.Err() != nil {
 			return
 		}
-		fmt.Println("err reading: ", err)
+		if err != nil && !timedOut {
+			slog.Warn("error watching partition owners", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.cfg.PollInterval):
+			}
+		}
+
+		if len(w.claim(ctx, w.pending(partitions))) > 0 {
+			cancel()
+			return
+		}
+	}
+}
+
+// pending returns the partitions we do not hold yet
+func (w *Worker) pending(partitions []types.PartitionID) []types.PartitionID {
+	pending := make([]types.PartitionID, 0, len(partitions))
+	for _, partitionID := range partitions {
+		if _, ok := w.owner.Token(partitionID); !ok {
+			pending = append(pending, partitionID)
+		}
+	}
+
+	return pending
+}
+
+// releaseMoved hands over the held partitions the ring gave to another worker.
+// It runs between two runs, when nothing fetched from them is in-flight anymore
+func (w *Worker) releaseMoved(partitions []types.PartitionID) {
+	var moved []types.PartitionID
+	for _, partitionID := range w.owner.Held() {
+		if !slices.Contains(partitions, partitionID) {
+			moved = append(moved, partitionID)
+		}
+	}
+
+	if len(moved) == 0 {
 		return
 	}
 
-	w.metrics.IncrTask()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w.owner.Release(ctx, moved)
+
+	w.mu.Lock()
+	since := time.Since(w.rebalancedAt)
+	w.mu.Unlock()
 
-	slog.Info("worker processed task", "worker", w.workerID, "task", res[1], "partition", res[0])
+	w.metrics.ObserveHandoff(metrics.HandoffRelease, since)
+	slog.Info("released partitions", "partitions", moved, "latency", since)
 }
 
-func (w *Worker) CreateEtcdPrometheusDiscovery() {
-	etcdCli := w.conn.GetEtcd()
+// stamp sets the fencing token of the claim the delivery was fetched under
+func (w *Worker) stamp(d *queue.Delivery) {
+	d.Token, _ = w.owner.Token(d.Partition)
+}
 
-	w.metricsPort = fmt.Sprintf("%d", 11111+(os.Getpid()%1000))
+// settleFailed logs a delivery that could not be settled. A stale owner is
+// expected after losing a partition: the task was handed back to the new owner
+func (w *Worker) settleFailed(d *queue.Delivery, msg string, err error, args ...any) {
+	if errors.Is(err, queue.ErrStaleOwner) {
+		w.metrics.IncrFenced()
+		slog.Warn("partition has a newer owner, task handed back", "partition", d.Source, "token", d.Token)
+		return
+	}
 
-	key := fmt.Sprintf("worker_metrics:%s", w.workerID)
-	endpoint := fmt.Sprintf("localhost:%s", w.metricsPort)
-	_, err := etcdCli.Put(context.Background(), key, endpoint, etcd.WithLease(etcd.LeaseID(w.leaseID)))
-	if err != nil {
-		log.Fatalf("error putting etcd worker key: %v", err)
+	slog.Error(msg, append(args, "partition", d.Source, "error", err)...)
+}
+
+// rebalance stops the current RunTask, in-flight tasks are drained
+func (w *Worker) rebalance() {
+	w.mu.Lock()
+	w.rebalancedAt = time.Now()
+	w.cancel()
+	w.mu.Unlock()
+}
+
+// process runs the task handler and settles the delivery. Settling is not bound
+// to the rebalance context, a processed task must not be redelivered
+func (w *Worker) process(ctx context.Context, d *queue.Delivery) {
+	t, ok := w.decode(d)
+	if !ok || w.forward(d, t) {
+		return
+	}
+
+	err := w.handle(ctx, d, t)
+	if err == nil {
+		w.succeeded(d, t)
+		return
+	}
+
+	delay, ok := w.failed(d, t, err)
+	if !ok {
+		return
+	}
+
+	slog.Warn("task failed, scheduling retry", "worker", w.workerID, "task", t.ID, "type", t.Type, "attempt", t.Attempt, "delay", delay, "partition", d.Source, "error", err)
+
+	raw, ok := w.encode(d, t)
+	if !ok {
 		return
 	}
+
+	if err := w.queue.Retry(context.Background(), d, raw, time.Now().Add(delay)); err != nil {
+		// the delivery stays in the processing list and comes back with the reaper
+		w.settleFailed(d, "error scheduling retry", err, "task", t.ID)
+		return
+	}
+
+	w.metrics.IncrRetry(t.Type)
+}
+
+// decode dead letters deliveries that are not a valid task
+func (w *Worker) decode(d *queue.Delivery) (*task.Task, bool) {
+	t, err := task.Decode([]byte(d.Raw))
+	if err != nil {
+		w.metrics.IncrFailedTask("")
+		slog.Error("task could not be decoded", "partition", d.Source, "error", err)
+		w.deadLetter(d, nil, dlq.ReasonDecodeFailed, err)
+		return nil, false
+	}
+	return t, true
 }
 
-func (w *Worker) CreateLease() {
-	etcdCli := w.conn.GetEtcd()
+// encode writes the updated task with the codec its producer used
+func (w *Worker) encode(d *queue.Delivery, t *task.Task) ([]byte, bool) {
+	raw, err := task.CodecOf([]byte(d.Raw)).Encode(t)
+	if err != nil {
+		slog.Error("error encoding task", "task", t.ID, "error", err)
+		w.deadLetter(d, t, dlq.ReasonEncodeFailed, err)
+		return nil, false
+	}
+	return raw, true
+}
+
+func (w *Worker) succeeded(d *queue.Delivery, t *task.Task) {
+	w.metrics.IncrTask()
+	w.metrics.ObserveAttempts(t.Type, t.Attempt+1)
+	slog.Info("worker processed task", "worker", w.workerID, "task", t.ID, "type", t.Type, "attempt", t.Attempt, "partition", d.Source, "priority", d.Priority)
+	w.ack(d)
+}
+
+// failed records a failed attempt and returns the delay before the next one.
+// When the retries are exhausted the task is dead lettered and false is returned
+func (w *Worker) failed(d *queue.Delivery, t *task.Task, err error) (time.Duration, bool) {
+	w.metrics.IncrFailedTask(t.Type)
+	t.Attempt++
+
+	delay, ok := w.handlers.RetryPolicy(t.Type).Next(t.Attempt)
+	if !ok {
+		w.metrics.ObserveAttempts(t.Type, t.Attempt)
+		slog.Error("task failed, retries exhausted", "worker", w.workerID, "task", t.ID, "type", t.Type, "attempts", t.Attempt, "partition", d.Source, "error", err)
+		w.deadLetter(d, t, dlq.ReasonRetriesExhausted, err)
+		return 0, false
+	}
 
-	ctx := context.Background()
+	return delay, true
+}
 
-	l := etcd.NewLease(etcdCli)
+func (w *Worker) ack(d *queue.Delivery) {
+	if err := w.queue.Ack(context.Background(), d); err != nil {
+		w.settleFailed(d, "error acking task", err, "task", d.Raw)
+	}
+}
 
-	leaseResp, err := l.Grant(ctx, 10)
+// deadLetter moves the delivery to the partition dead letter list. If that fails
+// the delivery is left in-flight rather than dropped
+func (w *Worker) deadLetter(d *queue.Delivery, t *task.Task, reason string, cause error) {
+	entry, err := dlq.NewEntry(d.Partition, d.Source, []byte(d.Raw), t, reason, cause, w.workerID).Marshal()
 	if err != nil {
-		slog.Warn("error issuing lease", "error", leaseResp)
+		slog.Error("error encoding dead letter", "partition", d.Source, "error", err)
 		return
 	}
 
-	w.leaseID = int64(leaseResp.ID)
+	if err := w.queue.DeadLetter(context.Background(), d, entry); err != nil {
+		w.settleFailed(d, "error dead lettering task", err, "reason", reason)
+		return
+	}
 
-	keepAliveChan, err := etcdCli.KeepAlive(ctx, leaseResp.ID)
-	if err != nil {
-		log.Fatalf("err trying to keep lease alive: %v", err)
+	w.metrics.IncrDeadLettered(reason)
+}
+
+// promoteLoop moves due delayed tasks and retries of the partitions this worker
+// holds into their tasks:N list
+func (w *Worker) promoteLoop() {
+	ticker := time.NewTicker(w.cfg.PromoteInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		partitions := w.owner.Held()
+		if len(partitions) == 0 {
+			continue
+		}
+
+		promoted, err := w.scheduler.Promote(w.runCtx, partitions, time.Now())
+		if err != nil {
+			if w.runCtx.Err() != nil {
+				return
+			}
+			slog.Error("error promoting due tasks", "error", err)
+		}
+
+		if promoted > 0 {
+			slog.Info("promoted due tasks", "tasks", promoted)
+		}
 	}
+}
 
-	go func() {
-		for {
-			select {
-			case ka, ok := <-keepAliveChan:
-				if !ok {
-					slog.Info("keep alive channel closed")
-					return
-				}
+// cronLoop fires the recurring jobs that map to partitions this worker holds
+func (w *Worker) cronLoop() {
+	ticker := time.NewTicker(w.cfg.CronInterval)
+	defer ticker.Stop()
 
-				slog.Info("lease renewed succesfully", "New TTL", ka.TTL)
+	owns := func(partitionID types.PartitionID) bool {
+		_, ok := w.owner.Token(partitionID)
+		return ok
+	}
 
-			case <-ctx.Done():
-				slog.Info("context canceled. Stopping monitor")
+	for now := range ticker.C {
+		fired, err := w.cron.Tick(w.runCtx, now, owns)
+		if err != nil {
+			if w.runCtx.Err() != nil {
 				return
 			}
+			slog.Error("error running cron jobs", "error", err)
 		}
-	}()
 
-	workerID := fmt.Sprintf("worker_id:%s", w.workerID)
+		if fired > 0 {
+			slog.Info("fired cron jobs", "jobs", fired)
+		}
+	}
+}
+
+// reapLoop periodically returns in-flight tasks of workers that are no longer
+// registered in etcd, and right away when a worker leaves
+func (w *Worker) reapLoop() {
+	ticker := time.NewTicker(w.cfg.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.reapChan:
+		}
 
-	resp, err := etcdCli.Get(ctx, workerID)
+		w.reap()
+	}
+}
+
+func (w *Worker) reap() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.ReapInterval)
+	defer cancel()
+
+	resp, err := w.conn.GetEtcd().Get(ctx, registry.Prefix, etcd.WithPrefix(), etcd.WithKeysOnly())
 	if err != nil {
-		log.Fatalf("error getting etcd worker key: %v", err)
+		// without a membership snapshot every worker would look dead
+		slog.Warn("skipping reap, could not list workers", "error", err)
 		return
 	}
 
-	if resp.Count == 0 {
-		_, err := etcdCli.Put(ctx, workerID, "live", etcd.WithLease(leaseResp.ID))
-		if err != nil {
-			log.Fatalf("error putting etcd worker key: %v", err)
-			return
+	alive := map[types.WorkerID]bool{w.workerID: true}
+	for _, kv := range resp.Kvs {
+		if workerID, ok := registry.WorkerID(kv.Key); ok {
+			alive[workerID] = true
 		}
+	}
+
+	recovered, err := w.queue.Recover(ctx, alive)
+	if err != nil {
+		slog.Error("error recovering in-flight tasks", "error", err)
+	}
+
+	if recovered > 0 {
+		slog.Warn("recovered in-flight tasks from dead workers", "tasks", recovered)
+		w.metrics.IncrRecovered(uint64(recovered))
+	}
+}
+
+// record is the registration published under worker_id:, it also tells
+// prometheus where to scrape the worker
+func (w *Worker) record() registry.Record {
+	return registry.Record{
+		Version:         registry.Version,
+		Hostname:        w.hostname,
+		Zone:            w.cfg.Zone,
+		Weight:          w.weight,
+		TaskTypes:       w.handlers.TaskTypes(),
+		MetricsEndpoint: fmt.Sprintf("localhost:%s", w.metricsPort),
+		StartedAt:       w.startedAt,
+	}
+}
+
+func (w *Worker) CreateLease() {
+	if err := w.register(context.Background()); err != nil {
+		log.Fatalf("error registering worker: %v", err)
+	}
+}
+
+// register grants a new lease, keeps it alive and puts the worker_id: key under it
+func (w *Worker) register(ctx context.Context) error {
+	etcdCli := w.conn.GetEtcd()
+
+	leaseResp, err := etcdCli.Grant(ctx, 10)
+	if err != nil {
+		return fmt.Errorf("issuing lease: %w", err)
+	}
+
+	// keepalives stop on shutdown, before the lease is revoked
+	keepAliveCtx, cancel := context.WithCancel(w.runCtx)
+
+	keepAliveChan, err := etcdCli.KeepAlive(keepAliveCtx, leaseResp.ID)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("keeping lease alive: %w", err)
+	}
 
+	record, err := w.record().Marshal()
+	if err != nil {
+		cancel()
+		return fmt.Errorf("encoding worker registration: %w", err)
 	}
+
+	// the key may still be attached to a lost lease, it is always rewritten
+	_, err = etcdCli.Put(ctx, registry.Key(w.workerID), record, etcd.WithLease(leaseResp.ID))
+	if err != nil {
+		// the lease expires on its own without keepalives
+		cancel()
+		return fmt.Errorf("putting etcd worker key: %w", err)
+	}
+
+	w.leaseID.Store(int64(leaseResp.ID))
+	go w.monitorLease(leaseResp.ID, keepAliveChan, cancel)
+
+	return nil
 }
 
-func (w *Worker) GetWorkers() []*Worker {
-	resp, err := w.conn.GetEtcd().Get(context.Background(), "worker_id", etcd.WithPrefix())
+func (w *Worker) lease() etcd.LeaseID {
+	return etcd.LeaseID(w.leaseID.Load())
+}
+
+// GetWorkers lists the registered workers and the etcd revision of the listing
+func (w *Worker) GetWorkers() ([]*Worker, int64) {
+	resp, err := w.conn.GetEtcd().Get(context.Background(), registry.Prefix, etcd.WithPrefix())
 	if err != nil {
 		log.Fatalf("err fetching workers from etcd: %v", err)
 	}
@@ -234,75 +725,73 @@ func (w *Worker) GetWorkers() []*Worker {
 	workers := make([]*Worker, 0)
 
 	for _, kv := range resp.Kvs {
-		parts := strings.Split(string(kv.Key), ":")
-		if len(parts) < 2 {
+		workerID, ok := registry.WorkerID(kv.Key)
+		if !ok {
 			continue
 		}
-		workerID := parts[1]
 
-		workers = append(workers, &Worker{
-			workerID: types.WorkerID(workerID),
-			leaseID:  kv.Lease,
-		})
+		record := registry.Parse(kv.Value)
+
+		worker := &Worker{
+			workerID:  workerID,
+			weight:    record.Weight,
+			taskTypes: record.TaskTypes,
+			hostname:  record.Hostname,
+			zone:      record.Zone,
+		}
+		worker.leaseID.Store(kv.Lease)
+		workers = append(workers, worker)
 
-		slog.Info("GetWorkers", "worker_id", workerID, "leaseID", kv.Lease)
+		slog.Info("GetWorkers", "worker_id", workerID, "leaseID", kv.Lease, "weight", record.Weight, "zone", record.Zone, "task_types", record.TaskTypes)
 	}
 
-	return workers
+	return workers, resp.Header.Revision
 }
 
 func (w *Worker) GetWorkerID() types.WorkerID {
 	return w.workerID
 }
 
-func (w *Worker) WatchWorkers() {
-	ctx := context.Background()
-
-	watchCh := w.conn.GetEtcd().Watch(ctx, "worker_id:", etcd.WithPrefix())
+// WatchWorkers follows worker_id: from fromRevision and feeds the membership
+// changes to the ring. After a compaction the registry is listed again and the
+// ring rebuilt from that snapshot
+func (w *Worker) WatchWorkers(fromRevision int64) {
+	changes := make(chan memberChange)
+	snapshots := make(chan map[types.WorkerID]ring.Member)
+	go w.settleMembership(changes, snapshots)
+
+	watcher := watch.NewWatcher(w.conn.GetEtcd(), "workers", registry.Prefix, watch.Handler{
+		Reset: func(kvs []*mvccpb.KeyValue) {
+			members := make(map[types.WorkerID]ring.Member, len(kvs))
+			for _, kv := range kvs {
+				if workerID, ok := registry.WorkerID(kv.Key); ok {
+					members[workerID] = member(registry.Parse(kv.Value))
+				}
+			}
+			snapshots <- members
+		},
+		Apply: func(event *etcd.Event) {
+			workerID, ok := registry.WorkerID(event.Kv.Key)
+			if !ok {
+				return
+			}
 
-	go func() {
-		for {
-			select {
-			case watchResp := <-watchCh:
-				for _, event := range watchResp.Events {
-					switch event.Type {
-					case etcd.EventTypePut:
-						// new worker joined or updated
-						parts := strings.Split(string(event.Kv.Key), ":")
-						if len(parts) >= 2 {
-							workerID := parts[1]
-							slog.Info("🟢 Worker joined", "id", workerID, "lease", event.Kv.Lease)
-
-							// ------- recalcular partitions aqui com consistent hashing
-							w.chr.AddNodes(types.WorkerID(workerID))
-
-							myPartitions := w.chr.FetchPartitionsForNode(w.workerID)
-
-							w.updateChan <- struct{}{}
-							slog.Warn("worker agora é dono das partitions", "partitions", myPartitions)
-						}
-					case etcd.EventTypeDelete:
-						// worker exited / lease expired
-						parts := strings.Split(string(event.Kv.Key), ":")
-						if len(parts) >= 2 {
-							workerID := parts[1]
-							slog.Info("🔴 Worker left", "id", workerID)
-
-							// ------- recalcular partitions aqui com consistent hashing
-							w.chr.RemoveNode(types.WorkerID(workerID))
-
-							myPartitions := w.chr.FetchPartitionsForNode(w.workerID)
-							slog.Warn("worker agora é dono das partitions", "partitions", myPartitions)
-
-							w.updateChan <- struct{}{}
-						}
-					}
+			switch event.Type {
+			case etcd.EventTypePut:
+				// new worker joined or updated
+				changes <- memberChange{
+					workerID: workerID,
+					member:   member(registry.Parse(event.Kv.Value)),
+					joined:   true,
 				}
-			case <-ctx.Done():
-				slog.Debug("ctx closed")
+			case etcd.EventTypeDelete:
+				// worker exited / lease expired
+				changes <- memberChange{workerID: workerID}
 			}
-		}
-	}()
+		},
+	}, w.metrics)
+
+	go watcher.Run(w.runCtx, fromRevision)
 }
 
 func (w *Worker) GetMetricsPort() string {
@@ -314,16 +803,30 @@ func (w *Worker) GetMetricsPort() string {
 func (w *Worker) Shutdown() {
 	slog.Info("shutting down worker gracefully...")
 
-	// canceling any processment (stops blpop)
-	w.cancel()
+	// stop fetching and let in-flight tasks finish, handlers still running after
+	// the drain timeout are canceled
+	w.closing.Store(true)
+	w.rebalance()
+
+	select {
+	case <-w.done:
+	case <-time.After(w.cfg.DrainTimeout + 5*time.Second):
+		slog.Warn("in-flight tasks did not drain in time")
+	}
+
+	w.stop()
+
+	// publish the drained partitions as released instead of letting them go
+	// with the lease, their next owners know the handoff was clean
+	w.releaseMoved(nil)
 
-	if w.leaseID != 0 {
+	if w.lease() != 0 {
 		slog.Info("revoking worker lease...")
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		_, err := w.conn.GetEtcd().Revoke(ctx, etcd.LeaseID(w.leaseID))
+		_, err := w.conn.GetEtcd().Revoke(ctx, w.lease())
 		if err != nil {
 			slog.Warn("failed to revoke lease", "error", err)
 		} else {